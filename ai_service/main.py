@@ -1,6 +1,6 @@
 from fastapi import FastAPI, UploadFile, File, HTTPException
 from pydantic import BaseModel
-from PIL import Image
+from PIL import Image, UnidentifiedImageError
 import pytesseract
 import io
 from ultralytics import YOLO
@@ -24,19 +24,163 @@ import json
 import threading
 import time
 import os
+import requests
+import redis
+
+# ImageQueue in internal/queue/messages.go. It replaced
+# image_processing_queue, which the backend drains and deletes.
+IMAGE_QUEUE = 'ai.image_jobs'
+RESULTS_QUEUE = 'image_results_queue'
+MODEL_NAME = os.getenv("MODEL_NAME", "yolov8n")
+
+# Must match cancelKeyPrefix in the backend's internal/queue/cancel.go.
+CANCEL_KEY_PREFIX = "inventory_ai:ai:cancelled:"
+redis_client = redis.Redis.from_url(os.getenv("REDIS_URL", "redis://redis:6379"))
+
+# Extra model versions requested by re-runs, loaded on first use.
+models = {MODEL_NAME: model}
+models_lock = threading.Lock()
+
+def get_model(version):
+    if not version or version == MODEL_NAME:
+        return model
+    with models_lock:
+        if version not in models:
+            models[version] = YOLO(f"{version}.pt")
+        return models[version]
+
+def is_cancelled(job):
+    key = f"{CANCEL_KEY_PREFIX}{job.get('job_id')}:{job.get('run', 0)}"
+    try:
+        return bool(redis_client.exists(key))
+    except redis.RedisError as e:
+        # Late results of cancelled jobs are ignored by the backend anyway.
+        print(f"Could not check cancellation of {key}: {e}")
+        return False
+
+# Must match AttemptHeader in the backend's internal/queue/retry.go.
+ATTEMPT_HEADER = "x-attempt"
+# How often one attempt of a job may be delivered without being acked (a
+# worker crashing on it, or just losing its connection) before it counts
+# as failed.
+MAX_DELIVERIES = int(os.getenv("AI_MAX_DELIVERIES", "3"))
+DELIVERY_KEY_PREFIX = "inventory_ai:ai:deliveries:"
+
+def attempt_of(properties):
+    """The job's attempt number, from 0: the failures the backend's retry
+    router counted, or else how often the broker dead-lettered it."""
+    headers = properties.headers or {}
+    if ATTEMPT_HEADER in headers:
+        return int(headers[ATTEMPT_HEADER])
+    return sum(int(d.get("count", 0)) for d in headers.get("x-death") or []
+               if d.get("queue") == IMAGE_QUEUE and d.get("reason") == "rejected")
+
+def count_delivery(job, attempt):
+    """Counts a delivery of the job's attempt and returns how many there
+    have been."""
+    key = f"{DELIVERY_KEY_PREFIX}{job.get('job_id')}:{job.get('run', 0)}:{attempt}"
+    try:
+        n = redis_client.incr(key)
+        redis_client.expire(key, 24 * 3600)
+        return n
+    except redis.RedisError as e:
+        print(f"Could not count deliveries of {key}: {e}")
+        return 1
+
+def run_analysis(image, model=model, conf=None):
+    """Run object detection + OCR on a PIL image."""
+    results = model(image, conf=conf) if conf else model(image)
+
+    labels = []
+    confidences = {}
+    for result in results:
+        for box in result.boxes:
+            class_id = int(box.cls[0])
+            label = model.names[class_id]
+            labels.append(label)
+            confidences.setdefault(label, []).append(float(box.conf[0]))
+
+    detected_items = []
+    for label, count in Counter(labels).items():
+        scores = confidences.get(label) or [1.0]
+        detected_items.append({
+            "name": label,
+            "qty": count,
+            "confidence": sum(scores) / len(scores),
+        })
+
+    try:
+        raw_text = pytesseract.image_to_string(image)
+    except Exception as e:
+        raw_text = f"Error performing OCR: {e}"
+
+    return detected_items, raw_text.strip()
+
+def publish_result(ch, job, status, **fields):
+    payload = {
+        "job_id": job.get("job_id"),
+        "tenant_id": job.get("tenant_id"),
+        "status": status,
+        "model": job.get("model_version") or MODEL_NAME,
+        "run": job.get("run", 0),
+        "timestamp": int(time.time()),
+    }
+    payload.update(fields)
+    ch.basic_publish(
+        exchange='',
+        routing_key=RESULTS_QUEUE,
+        body=json.dumps(payload),
+        properties=pika.BasicProperties(content_type='application/json', delivery_mode=2),
+    )
 
 def process_job(ch, method, properties, body):
     print(f" [x] Received job: {body}")
-    # In real app: Download image, process, then hit a webhook or update DB
-    # For now we just log it
-    
+
+    try:
+        job = json.loads(body)
+    except Exception as e:
+        print(f"Rejecting malformed job: {e}")
+        ch.basic_nack(delivery_tag=method.delivery_tag, requeue=False)
+        return
+
+    attempt = attempt_of(properties)
+    if count_delivery(job, attempt) > MAX_DELIVERIES:
+        # This attempt keeps coming back unacked, most likely because it
+        # crashes the worker. Fail it: the backend retries it later or
+        # dead-letters it once its attempts are used up.
+        print(f"Job {job.get('job_id')} attempt {attempt} delivered more than {MAX_DELIVERIES} times, rejecting")
+        ch.basic_nack(delivery_tag=method.delivery_tag, requeue=False)
+        return
+
+    if is_cancelled(job):
+        print(f"Skipping cancelled job {job.get('job_id')}")
+        ch.basic_ack(delivery_tag=method.delivery_tag)
+        return
+
+    print(f"Processing image for user: {job.get('user_id')}")
+    publish_result(ch, job, "processing")
     try:
-        data = json.loads(body)
-        print(f"Processing image for user: {data.get('user_id')}")
-        # Logic from analyze_image would go here
+        job_model = get_model(job.get("model_version"))
+        if not job_model:
+            raise RuntimeError("AI Model not loaded")
+        resp = requests.get(job["image_url"], timeout=30)
+        resp.raise_for_status()
+        try:
+            image = Image.open(io.BytesIO(resp.content))
+        except UnidentifiedImageError as e:
+            # Retrying will not make a bad image readable.
+            publish_result(ch, job, "failed", error=f"Invalid image file: {e}")
+            ch.basic_ack(delivery_tag=method.delivery_tag)
+            return
+        items, raw_text = run_analysis(image, job_model, job.get("confidence_threshold"))
     except Exception as e:
-        print(f"Error processing job: {e}")
+        print(f"Error processing job (will be retried): {e}")
+        ch.basic_nack(delivery_tag=method.delivery_tag, requeue=False)
+        return
 
+    publish_result(ch, job, "succeeded",
+                   detections=[{"name": i["name"], "quantity": i["qty"], "confidence": i["confidence"]} for i in items],
+                   raw_text=raw_text)
     ch.basic_ack(delivery_tag=method.delivery_tag)
 
 def start_consumer():
@@ -48,10 +192,17 @@ def start_consumer():
                 pika.ConnectionParameters(host=rabbitmq_host))
             channel = connection.channel()
 
-            channel.queue_declare(queue='image_processing_queue', durable=True)
+            # Arguments must match the backend's declaration (NewTopology in
+            # internal/queue/broker.go).
+            channel.queue_declare(queue=IMAGE_QUEUE, durable=True, arguments={
+                'x-dead-letter-exchange': 'ai.dlx',
+                'x-dead-letter-routing-key': 'image_processing_failed',
+                'x-max-priority': 5,
+            })
+            channel.queue_declare(queue=RESULTS_QUEUE, durable=True)
 
             channel.basic_qos(prefetch_count=1)
-            channel.basic_consume(queue='image_processing_queue', on_message_callback=process_job)
+            channel.basic_consume(queue=IMAGE_QUEUE, on_message_callback=process_job)
 
             print(' [*] Waiting for messages. To exit press CTRL+C')
             channel.start_consuming()
@@ -78,36 +229,12 @@ async def analyze_image(file: UploadFile = File(...)):
     except Exception:
         raise HTTPException(status_code=400, detail="Invalid image file")
 
-    # 2. Object Detection (YOLO)
-    # Run inference
-    results = model(image)
-    
-    detected_items = []
-    # Count occurrences
-    labels = []
-    for result in results:
-        for box in result.boxes:
-            class_id = int(box.cls[0])
-            label = model.names[class_id]
-            labels.append(label)
-
-    counts = Counter(labels)
-    for label, count in counts.items():
-        detected_items.append({
-            "name": label,
-            "qty": count,
-            "confidence": 1.0 # Simplified for aggregation
-        })
-
-    # 3. OCR (Text Extraction)
-    try:
-        raw_text = pytesseract.image_to_string(image)
-    except Exception as e:
-        raw_text = f"Error performing OCR: {e}"
+    # 2. Object Detection (YOLO) + 3. OCR (Text Extraction)
+    detected_items, raw_text = run_analysis(image)
 
     return {
         "items": detected_items,
-        "raw_text": raw_text.strip()
+        "raw_text": raw_text
     }
 
 if __name__ == "__main__":
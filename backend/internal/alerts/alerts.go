@@ -0,0 +1,324 @@
+// Package alerts watches item quantities against their reorder settings.
+// Item events arrive from the broker (queue.StockAlertsQueue); for each one
+// the evaluator re-reads the item and raises, updates or resolves its stock
+// alert, with a suggested quantity to reorder.
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"time"
+
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/queue"
+	"github.com/inventory_ai/backend/internal/units"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+)
+
+const (
+	// wakeInterval is how often snoozed alerts are checked for waking up.
+	wakeInterval = time.Minute
+	// sweepInterval is how often every item with reorder settings is
+	// evaluated again, catching changes whose events were missed.
+	sweepInterval = 6 * time.Hour
+)
+
+// Collection returns the stock alerts collection.
+func Collection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("stock_alerts")
+}
+
+// EnsureIndexes creates the indexes behind alert listing and the one
+// active alert per item.
+func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := Collection(db).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "item_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"active": true}),
+		},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "status", Value: 1}, {Key: "raised_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "snoozed_until", Value: 1}}},
+	})
+	return err
+}
+
+// threshold is the quantity at or below which item is low on stock: its
+// reorder point, or its minimum when it has none.
+func threshold(item models.Item) float64 {
+	if item.ReorderPoint > 0 {
+		return item.ReorderPoint
+	}
+	return item.MinQuantity
+}
+
+// Level returns how low item's stock is against its reorder settings:
+// models.AlertLow, models.AlertCritical, or "" when it is sufficient or
+// the item has no settings.
+func Level(item models.Item) string {
+	if threshold(item) <= 0 {
+		return ""
+	}
+	switch {
+	case item.Quantity <= 0 || item.Quantity < item.MinQuantity:
+		return models.AlertCritical
+	case item.Quantity <= threshold(item):
+		return models.AlertLow
+	}
+	return ""
+}
+
+// Suggest returns how much of item to reorder, given the quantity already
+// on its way: enough to bring it up to its maximum, or to twice its
+// threshold when it has none, rounded up to a whole unit.
+func Suggest(item models.Item, incoming float64) float64 {
+	target := item.MaxQuantity
+	if target <= 0 {
+		target = 2 * threshold(item)
+	}
+	return math.Max(0, math.Ceil(target-item.Quantity-incoming))
+}
+
+// Evaluator keeps stock alerts in line with item quantities.
+type Evaluator struct {
+	Mongo  *mongo.Database
+	PG     *gorm.DB // tenants' units, to convert incoming stock
+	Broker queue.Broker
+}
+
+func NewEvaluator(db *mongo.Database, pg *gorm.DB, broker queue.Broker) *Evaluator {
+	return &Evaluator{Mongo: db, PG: pg, Broker: broker}
+}
+
+// Run consumes item events, wakes snoozed alerts and periodically sweeps
+// all items until ctx is cancelled.
+func (e *Evaluator) Run(ctx context.Context) {
+	go func() {
+		if err := e.Broker.Consume(ctx, queue.StockAlertsQueue, e.handle); err != nil && ctx.Err() == nil {
+			log.Printf("alerts: event consumer stopped: %v", err)
+		}
+	}()
+
+	ticker := time.NewTicker(wakeInterval)
+	defer ticker.Stop()
+	lastSweep := time.Time{}
+	for {
+		if time.Since(lastSweep) > sweepInterval {
+			if err := e.sweep(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("alerts: sweep failed: %v", err)
+			}
+			lastSweep = time.Now()
+		}
+		if err := e.wake(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("alerts: waking snoozed alerts failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handle evaluates the item an event is about. The event only says which
+// item changed; its current state is read again, so events handled late
+// or out of order cannot leave a stale alert.
+func (e *Evaluator) handle(ctx context.Context, del *queue.Delivery) {
+	tenantID, _ := del.Headers[queue.TenantHeader].(string)
+	var ref struct {
+		ID primitive.ObjectID `json:"id"`
+	}
+	if err := json.Unmarshal(del.Body, &ref); err != nil || tenantID == "" || ref.ID.IsZero() {
+		del.Ack()
+		return
+	}
+	if err := e.Evaluate(ctx, tenantID, ref.ID); err != nil {
+		log.Printf("alerts: evaluate item %s failed: %v", ref.ID.Hex(), err)
+		time.Sleep(time.Second)
+		del.Nack(true)
+		return
+	}
+	del.Ack()
+}
+
+// Evaluate raises, updates or resolves the alert of the tenant's item.
+func (e *Evaluator) Evaluate(ctx context.Context, tenantID string, itemID primitive.ObjectID) error {
+	var item models.Item
+	err := e.Mongo.Collection("items").FindOne(ctx, bson.M{"_id": itemID, "tenant_id": tenantID}).Decode(&item)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	level := ""
+	if err == nil && (item.Status == "" || item.Status == models.ItemStatusActive) {
+		level = Level(item)
+	}
+	if level == "" {
+		return e.resolve(ctx, itemID)
+	}
+
+	incoming, err := e.incoming(ctx, item)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	set := bson.M{
+		"name":               item.Name,
+		"sku":                item.SKU,
+		"warehouse_id":       item.WarehouseID,
+		"level":              level,
+		"quantity":           item.Quantity,
+		"unit":               item.Unit,
+		"reorder_point":      threshold(item),
+		"min_quantity":       item.MinQuantity,
+		"max_quantity":       item.MaxQuantity,
+		"incoming":           incoming,
+		"suggested_quantity": Suggest(item, incoming),
+		"updated_at":         now,
+	}
+	var current models.StockAlert
+	err = Collection(e.Mongo).FindOne(ctx, bson.M{"item_id": itemID, "active": true}).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		set["tenant_id"] = tenantID
+		set["status"] = models.AlertOpen
+		set["raised_at"] = now
+		_, err = Collection(e.Mongo).UpdateOne(ctx,
+			bson.M{"item_id": itemID, "active": true},
+			bson.M{"$set": set},
+			options.Update().SetUpsert(true))
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": set}
+	if level == models.AlertCritical && current.Level != models.AlertCritical && current.Status != models.AlertOpen {
+		// Running out is news even to whoever acknowledged or snoozed the
+		// alert while stock was merely low.
+		set["status"] = models.AlertOpen
+		update["$unset"] = bson.M{"snoozed_until": ""}
+	}
+	_, err = Collection(e.Mongo).UpdateOne(ctx, bson.M{"_id": current.ID}, update)
+	return err
+}
+
+// resolve resolves the item's active alert, if any.
+func (e *Evaluator) resolve(ctx context.Context, itemID primitive.ObjectID) error {
+	now := time.Now()
+	_, err := Collection(e.Mongo).UpdateOne(ctx, bson.M{"item_id": itemID, "active": true}, bson.M{
+		"$set":   bson.M{"active": false, "status": models.AlertResolved, "resolved_at": now, "updated_at": now},
+		"$unset": bson.M{"snoozed_until": ""},
+	})
+	return err
+}
+
+// incoming is the stock of item's SKU in transit to its warehouse, in the
+// item's unit. Transfer lines are in their source item's unit, which need
+// not be the same; lines in a unit that does not convert into the item's
+// are left out.
+func (e *Evaluator) incoming(ctx context.Context, item models.Item) (float64, error) {
+	if item.SKU == "" {
+		return 0, nil
+	}
+	cursor, err := e.Mongo.Collection("stock_transfers").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"tenant_id":                item.TenantID,
+			"status":                   models.TransferInTransit,
+			"destination_warehouse_id": item.WarehouseID,
+			"lines.sku":                item.SKU,
+		}}},
+		{{Key: "$unwind", Value: "$lines"}},
+		{{Key: "$match", Value: bson.M{"lines.sku": item.SKU}}},
+		{{Key: "$group", Value: bson.M{"_id": "$lines.unit", "quantity": bson.M{"$sum": "$lines.quantity"}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var sums []unitSum
+	if err := cursor.All(ctx, &sums); err != nil || len(sums) == 0 {
+		return 0, err
+	}
+	cat, err := units.Load(e.PG, item.TenantID)
+	if err != nil {
+		return 0, err
+	}
+	return sumIn(cat, sums, item.Unit), nil
+}
+
+// unitSum is a quantity in a unit; "" is DefaultUnit.
+type unitSum struct {
+	Unit     string  `bson:"_id"`
+	Quantity float64 `bson:"quantity"`
+}
+
+// sumIn adds up sums in unit ("" being DefaultUnit), leaving out those in
+// units that do not convert into it.
+func sumIn(cat units.Catalogue, sums []unitSum, unit string) float64 {
+	if unit == "" {
+		unit = models.DefaultUnit
+	}
+	total := 0.0
+	for _, s := range sums {
+		from := s.Unit
+		if from == "" {
+			from = models.DefaultUnit
+		}
+		q, err := cat.Convert(s.Quantity, from, unit)
+		if err != nil {
+			continue
+		}
+		total += q
+	}
+	return units.Round(total)
+}
+
+// wake opens snoozed alerts whose snooze has run out.
+func (e *Evaluator) wake(ctx context.Context) error {
+	_, err := Collection(e.Mongo).UpdateMany(ctx,
+		bson.M{"status": models.AlertSnoozed, "snoozed_until": bson.M{"$lte": time.Now()}},
+		bson.M{"$set": bson.M{"status": models.AlertOpen, "updated_at": time.Now()}, "$unset": bson.M{"snoozed_until": ""}})
+	return err
+}
+
+// sweep evaluates every item with reorder settings and every item with an
+// active alert.
+func (e *Evaluator) sweep(ctx context.Context) error {
+	// Items and alerts both decode into an alert: an item's _id as the
+	// alert's id, an alert's item_id as its item.
+	evaluate := func(cursor *mongo.Cursor, itemID func(models.StockAlert) primitive.ObjectID) error {
+		defer cursor.Close(ctx)
+		for cursor.Next(ctx) {
+			var ref models.StockAlert
+			if err := cursor.Decode(&ref); err != nil {
+				return err
+			}
+			if err := e.Evaluate(ctx, ref.TenantID, itemID(ref)); err != nil {
+				return err
+			}
+		}
+		return cursor.Err()
+	}
+
+	cursor, err := e.Mongo.Collection("items").Find(ctx,
+		bson.M{"$or": bson.A{bson.M{"reorder_point": bson.M{"$gt": 0}}, bson.M{"min_quantity": bson.M{"$gt": 0}}}},
+		options.Find().SetProjection(bson.M{"tenant_id": 1}))
+	if err != nil {
+		return err
+	}
+	if err := evaluate(cursor, func(ref models.StockAlert) primitive.ObjectID { return ref.ID }); err != nil {
+		return err
+	}
+	// Items whose settings were removed or that are gone.
+	cursor, err = Collection(e.Mongo).Find(ctx, bson.M{"active": true},
+		options.Find().SetProjection(bson.M{"item_id": 1, "tenant_id": 1}))
+	if err != nil {
+		return err
+	}
+	return evaluate(cursor, func(ref models.StockAlert) primitive.ObjectID { return ref.ItemID })
+}
@@ -0,0 +1,97 @@
+package alerts
+
+import (
+	"testing"
+
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/units"
+)
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		item models.Item
+		want string
+	}{
+		{"no settings", models.Item{Quantity: 0}, ""},
+		{"above reorder point", models.Item{Quantity: 11, ReorderPoint: 10}, ""},
+		{"at reorder point", models.Item{Quantity: 10, ReorderPoint: 10}, models.AlertLow},
+		{"below reorder point", models.Item{Quantity: 4, ReorderPoint: 10}, models.AlertLow},
+		{"out of stock", models.Item{Quantity: 0, ReorderPoint: 10}, models.AlertCritical},
+		{"backordered", models.Item{Quantity: -2, ReorderPoint: 10}, models.AlertCritical},
+		{"below minimum", models.Item{Quantity: 4, ReorderPoint: 10, MinQuantity: 5}, models.AlertCritical},
+		{"at minimum", models.Item{Quantity: 5, ReorderPoint: 10, MinQuantity: 5}, models.AlertLow},
+		{"minimum only, at it", models.Item{Quantity: 5, MinQuantity: 5}, models.AlertLow},
+		{"minimum only, above", models.Item{Quantity: 6, MinQuantity: 5}, ""},
+		{"fractional", models.Item{Quantity: 0.5, ReorderPoint: 0.75, Unit: "kg"}, models.AlertLow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Level(tt.item); got != tt.want {
+				t.Fatalf("Level = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	tests := []struct {
+		name     string
+		item     models.Item
+		incoming float64
+		want     float64
+	}{
+		{"up to maximum", models.Item{Quantity: 3, ReorderPoint: 10, MaxQuantity: 50}, 0, 47},
+		{"twice the threshold without maximum", models.Item{Quantity: 3, ReorderPoint: 10}, 0, 17},
+		{"twice the minimum without reorder point", models.Item{Quantity: 1, MinQuantity: 4}, 0, 7},
+		{"less what is incoming", models.Item{Quantity: 3, ReorderPoint: 10, MaxQuantity: 50}, 20, 27},
+		{"nothing when incoming covers it", models.Item{Quantity: 3, ReorderPoint: 10, MaxQuantity: 50}, 60, 0},
+		{"backorders are made up", models.Item{Quantity: -5, ReorderPoint: 10, MaxQuantity: 50}, 0, 55},
+		{"rounded up to a whole unit", models.Item{Quantity: 0.4, ReorderPoint: 1, MaxQuantity: 2}, 0.5, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Suggest(tt.item, tt.incoming); got != tt.want {
+				t.Fatalf("Suggest = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSumIn(t *testing.T) {
+	cat := units.Catalogue{}
+	for _, u := range models.StandardUnits {
+		cat[u.Code] = u
+	}
+	cat["box"] = models.Unit{Code: "box", BaseCode: "pcs", Factor: 24}
+
+	tests := []struct {
+		name string
+		sums []unitSum
+		unit string
+		want float64
+	}{
+		{"same unit", []unitSum{{"box", 2}}, "box", 2},
+		{"default unit", []unitSum{{"", 5}, {"pcs", 3}}, "", 8},
+		{"boxes into pieces", []unitSum{{"box", 2}, {"pcs", 4}}, "pcs", 52},
+		{"pieces into boxes", []unitSum{{"pcs", 12}, {"box", 1}}, "box", 1.5},
+		{"dozens into boxes", []unitSum{{"dozen", 1}}, "box", 0.5},
+		{"other dimensions are left out", []unitSum{{"kg", 3}, {"box", 1}}, "pcs", 24},
+		{"unknown units are left out", []unitSum{{"crate", 3}}, "pcs", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sumIn(cat, tt.sums, tt.unit); got != tt.want {
+				t.Fatalf("sumIn = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The suggestion for an item kept in boxes counts incoming pieces as
+	// boxes, not one box each.
+	item := models.Item{Quantity: 1, Unit: "box", ReorderPoint: 2, MaxQuantity: 10}
+	incoming := sumIn(cat, []unitSum{{"pcs", 96}}, item.Unit)
+	if got := Suggest(item, incoming); got != 5 {
+		t.Fatalf("suggested %v boxes with %v incoming, want 5", got, incoming)
+	}
+}
@@ -0,0 +1,131 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisChannel carries events between backend replicas so a client gets
+// updates no matter which replica consumed the underlying message.
+const redisChannel = "inventory_ai:events"
+
+// subscriberBuffer is how many events a slow client may lag behind before
+// new events are dropped for it.
+const subscriberBuffer = 32
+
+// Event is a tenant-scoped notification pushed to connected clients.
+type Event struct {
+	Type     string      `json:"type"` // e.g. ai.job.updated
+	TenantID string      `json:"tenant_id"`
+	JobID    string      `json:"job_id,omitempty"`
+	Data     interface{} `json:"data,omitempty"`
+	At       time.Time   `json:"at"`
+}
+
+type subscriber struct {
+	ch    chan Event
+	jobID string
+}
+
+// Hub fans events out to the subscribers of each tenant. With a Redis client
+// events are relayed through Redis pub/sub; without one they stay in-process.
+type Hub struct {
+	Redis *redis.Client
+
+	mu   sync.RWMutex
+	subs map[string]map[*subscriber]struct{}
+}
+
+func NewHub(client *redis.Client) *Hub {
+	return &Hub{Redis: client, subs: map[string]map[*subscriber]struct{}{}}
+}
+
+// Subscribe registers for a tenant's events, optionally only those of one
+// job. The returned func must be called to unsubscribe.
+func (h *Hub) Subscribe(tenantID, jobID string) (<-chan Event, func()) {
+	sub := &subscriber{ch: make(chan Event, subscriberBuffer), jobID: jobID}
+
+	h.mu.Lock()
+	if h.subs[tenantID] == nil {
+		h.subs[tenantID] = map[*subscriber]struct{}{}
+	}
+	h.subs[tenantID][sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub.ch, func() {
+		h.mu.Lock()
+		delete(h.subs[tenantID], sub)
+		if len(h.subs[tenantID]) == 0 {
+			delete(h.subs, tenantID)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Publish sends an event to every subscriber of its tenant, across replicas
+// when Redis is configured.
+func (h *Hub) Publish(ev Event) {
+	if ev.At.IsZero() {
+		ev.At = time.Now()
+	}
+	if h.Redis != nil {
+		body, err := json.Marshal(ev)
+		if err == nil {
+			err = h.Redis.Publish(context.Background(), redisChannel, body).Err()
+		}
+		if err == nil {
+			return
+		}
+		log.Printf("events: redis publish failed, delivering locally: %v", err)
+	}
+	h.dispatch(ev)
+}
+
+// Run relays events published by any replica to local subscribers. It is a
+// no-op without Redis and returns when ctx is cancelled.
+func (h *Hub) Run(ctx context.Context) {
+	if h.Redis == nil {
+		return
+	}
+	// go-redis re-subscribes on its own after connection drops.
+	pubsub := h.Redis.Subscribe(ctx, redisChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var ev Event
+			if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+				log.Printf("events: dropping malformed event: %v", err)
+				continue
+			}
+			h.dispatch(ev)
+		}
+	}
+}
+
+func (h *Hub) dispatch(ev Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subs[ev.TenantID] {
+		if sub.jobID != "" && sub.jobID != ev.JobID {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			// Never block the publisher on a slow client.
+		}
+	}
+}
@@ -1,49 +1,383 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/inventory_ai/backend/internal/events"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/outbox"
 	"github.com/inventory_ai/backend/internal/queue"
+	"github.com/inventory_ai/backend/internal/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// DefaultMaxImageBytes caps a single uploaded image when no limit is configured.
+const DefaultMaxImageBytes = 10 << 20
+
+// allowedImageTypes maps sniffed content types to the extension we store them under.
+var allowedImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// Default limits of a batch upload: the number of images, and the size of
+// the whole request.
+const (
+	DefaultMaxBatchFiles = 50
+	DefaultMaxBatchBytes = 200 << 20
+)
+
+// Default per-tenant caps on open (pending, queued or processing) jobs.
+const (
+	DefaultMaxInFlight     = 100
+	DefaultMaxBulkInFlight = 50
+)
+
+// AIConfig holds the upload and fairness limits of the AI endpoints.
+type AIConfig struct {
+	MaxImageBytes int64
+	// MaxInFlight caps a tenant's open jobs of any priority, MaxBulkInFlight
+	// its open bulk jobs, so one tenant's backfill cannot starve the others.
+	MaxInFlight     int
+	MaxBulkInFlight int
+
+	MaxBatchFiles int
+	MaxBatchBytes int64
+
+	// Uploads within DedupeMaxDistance bits of a job's image hash from the
+	// last DedupeWindow are handled according to DedupeMode.
+	DedupeMode        string
+	DedupeWindow      time.Duration
+	DedupeMaxDistance int
+}
+
 type AIHandler struct {
-	Publisher *queue.Publisher
+	Mongo         *mongo.Database
+	Outbox        *outbox.Outbox
+	Store         storage.BlobStore
+	Events        *events.Hub
+	Cancellations *queue.Cancellations
+	AIConfig
+}
+
+func NewAIHandler(mongo *mongo.Database, ob *outbox.Outbox, store storage.BlobStore, hub *events.Hub, cancels *queue.Cancellations, cfg AIConfig) *AIHandler {
+	if cfg.MaxImageBytes <= 0 {
+		cfg.MaxImageBytes = DefaultMaxImageBytes
+	}
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = DefaultMaxInFlight
+	}
+	if cfg.MaxBulkInFlight <= 0 {
+		cfg.MaxBulkInFlight = DefaultMaxBulkInFlight
+	}
+	if cfg.MaxBatchFiles <= 0 {
+		cfg.MaxBatchFiles = DefaultMaxBatchFiles
+	}
+	if cfg.MaxBatchBytes <= 0 {
+		cfg.MaxBatchBytes = DefaultMaxBatchBytes
+	}
+	if cfg.DedupeMode == "" {
+		cfg.DedupeMode = DedupeReuse
+	}
+	if cfg.DedupeWindow <= 0 {
+		cfg.DedupeWindow = DefaultDedupeWindow
+	}
+	if cfg.DedupeMaxDistance <= 0 {
+		cfg.DedupeMaxDistance = DefaultDedupeMaxDistance
+	}
+	return &AIHandler{Mongo: mongo, Outbox: ob, Store: store, Events: hub, Cancellations: cancels, AIConfig: cfg}
 }
 
-func NewAIHandler(pub *queue.Publisher) *AIHandler {
-	return &AIHandler{Publisher: pub}
+func (h *AIHandler) jobs() *mongo.Collection {
+	return h.Mongo.Collection("ai_jobs")
 }
 
-func (h *AIHandler) QueueImageAnalysis(c *fiber.Ctx) error {
-	if h.Publisher == nil {
-		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
-			"error": "AI queue unavailable (RabbitMQ not connected)",
-		})
+// EnsureIndexes creates the indexes the job endpoints rely on.
+func (h *AIHandler) EnsureIndexes(ctx context.Context) error {
+	_, err := h.jobs().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "status", Value: 1}, {Key: "priority", Value: 1}}},
+		{Keys: bson.D{{Key: "batch_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = h.batches().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = h.Mongo.Collection("items").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "batch_id", Value: 1}, {Key: "status", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = h.deadLetters().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{
+			Keys: bson.D{{Key: "job_id", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"job_id": bson.M{"$exists": true}}),
+		},
+	})
+	return err
+}
+
+// uploadedImage is a validated image read from a multipart form.
+type uploadedImage struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+}
+
+// readImage validates size and (sniffed) content type of a multipart image field.
+func (h *AIHandler) readImage(c *fiber.Ctx, field string) (*uploadedImage, *fiber.Error) {
+	fh, err := c.FormFile(field)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Missing %q file in multipart form", field))
+	}
+	return h.readImageFile(fh)
+}
+
+// readImageFile validates a single multipart file header as an image.
+func (h *AIHandler) readImageFile(fh *multipart.FileHeader) (*uploadedImage, *fiber.Error) {
+	if fh.Size > h.MaxImageBytes {
+		return nil, h.tooLarge()
 	}
 
+	f, err := fh.Open()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Could not read uploaded file")
+	}
+	defer f.Close()
+	return h.readImageData(f)
+}
+
+func (h *AIHandler) tooLarge() *fiber.Error {
+	return fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("Image exceeds %d bytes", h.MaxImageBytes))
+}
+
+// readImageData enforces the size limit on r and sniffs its content type.
+func (h *AIHandler) readImageData(r io.Reader) (*uploadedImage, *fiber.Error) {
+	// Read one byte past the limit so an understated header size is still caught.
+	data, err := io.ReadAll(io.LimitReader(r, h.MaxImageBytes+1))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Could not read uploaded file")
+	}
+	if int64(len(data)) > h.MaxImageBytes {
+		return nil, h.tooLarge()
+	}
+	if len(data) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Uploaded file is empty")
+	}
+
+	// Trust the bytes, not the client-supplied Content-Type header.
+	contentType := http.DetectContentType(data)
+	ext, ok := allowedImageTypes[contentType]
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusUnsupportedMediaType, fmt.Sprintf("Unsupported image type %q", contentType))
+	}
+	return &uploadedImage{Data: data, ContentType: contentType, Ext: ext}, nil
+}
+
+// imageKey builds a tenant-scoped storage key for a new upload.
+func imageKey(tenantID, imageID, ext string) string {
+	return path.Join("tenants", tenantID, "images", time.Now().UTC().Format("2006/01"), imageID+ext)
+}
+
+func (h *AIHandler) QueueImageAnalysis(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
+	tenantID := c.Locals("tenant_id").(string)
+
+	priority := c.FormValue("priority", queue.PriorityNameInteractive)
+	if _, ok := queue.ParsePriority(priority); !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Priority must be interactive or bulk"})
+	}
+	if ferr := h.checkInFlight(tenantID, priority, 1); ferr != nil {
+		return h.rejectInFlight(c, ferr)
+	}
 
-	// In a real app, you'd upload the file to S3/Local first.
-	// Here we mock the URL or accept base64 in body for simplicity,
-	// OR (better) we say "Image uploaded to /tmp/..."
+	img, ferr := h.readImage(c, "image")
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+	}
 
-	// For this MVP, let's assume client sends a URL or we just mock an ID
-	// Real world: Multipart upload -> Save -> Get Path -> Queue Path
+	hash := hashImage(img)
+	if prior, distance := h.checkDuplicate(c, tenantID, hash); prior != nil {
+		return h.respondDuplicate(c, prior, distance)
+	}
 
-	job := queue.AIJob{
-		ImageID:   "img_" + time.Now().Format("20060102150405"),
-		UserID:    userID,
-		ImageURL:  "https://example.com/sample_inventory.jpg", // Placeholder
-		Timestamp: time.Now().Unix(),
+	record := models.AIJob{TenantID: tenantID, UserID: userID, Priority: priority, ImageHash: hash}
+	if ferr := h.queueImage(c.Context(), &record, img); ferr != nil {
+		return h.rejectInFlight(c, ferr)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":   "Image queued for processing",
+		"job_id":    record.ID,
+		"status":    record.Status,
+		"priority":  record.Priority,
+		"image_url": record.ImageURL,
+	})
+}
+
+// queueImage stores img and creates a pending job for it. record carries the
+// tenant, user, priority and batch; the rest is filled in.
+func (h *AIHandler) queueImage(ctx context.Context, record *models.AIJob, img *uploadedImage) *fiber.Error {
+	record.ID = uuid.NewString()
+	record.ImageID = "img_" + record.ID
+	obj, err := h.Store.Put(ctx, imageKey(record.TenantID, record.ImageID, img.Ext), bytes.NewReader(img.Data), img.ContentType)
+	if err != nil {
+		log.Printf("ai: store image failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not store image")
+	}
+
+	now := time.Now()
+	record.Status = models.AIJobPending
+	record.ImageURL = obj.URL
+	record.ImageKey = obj.Key
+	record.Run = 1
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	if err := h.createJob(context.TODO(), *record, record.ImageID); err != nil {
+		if ferr, ok := inFlightError(err); ok {
+			return ferr
+		}
+		log.Printf("ai: create job failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not create job")
 	}
+	return nil
+}
 
-	if err := h.Publisher.PublishJob(job); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to queue job"})
+// rejectInFlight writes an error of checkInFlight or queueImage, asking
+// clients to back off when the tenant is at a cap.
+func (h *AIHandler) rejectInFlight(c *fiber.Ctx, ferr *fiber.Error) error {
+	if ferr.Code == fiber.StatusTooManyRequests {
+		c.Set(fiber.HeaderRetryAfter, "30")
 	}
+	return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+}
 
-	return c.JSON(fiber.Map{
-		"message": "Image queued for processing",
-		"job_id":  job.ImageID,
+// createJob stores a new job record together with the outbox message that
+// hands it to the worker and the job's in-flight slot; the relay publishes
+// it and flips it to queued.
+func (h *AIHandler) createJob(ctx context.Context, record models.AIJob, imageID string) error {
+	err := h.Outbox.RunMongo(ctx, func(ctx context.Context) error {
+		if err := h.reserveInFlight(ctx, record.TenantID, record.Priority); err != nil {
+			return err
+		}
+		if _, err := h.jobs().InsertOne(ctx, record); err != nil {
+			return err
+		}
+		return h.enqueueJob(ctx, record, imageID)
 	})
+	if err != nil {
+		return err
+	}
+	h.emitJobUpdate(record, nil)
+	return nil
+}
+
+// enqueueJob writes the worker message for record to the outbox.
+func (h *AIHandler) enqueueJob(ctx context.Context, record models.AIJob, imageID string) error {
+	priority, ok := queue.ParsePriority(record.Priority)
+	if !ok {
+		priority = queue.PriorityInteractive
+	}
+	ev, err := outbox.NewJobEvent(queue.AIJob{
+		JobID:     record.ID,
+		TenantID:  record.TenantID,
+		ImageID:   imageID,
+		UserID:    record.UserID,
+		ImageURL:  h.Store.URL(record.ImageKey),
+		ImageKey:  record.ImageKey,
+		Priority:  priority,
+		Timestamp: time.Now().Unix(),
+
+		Run:                 record.Run,
+		ModelVersion:        record.ModelVersion,
+		ConfidenceThreshold: record.ConfidenceThreshold,
+	})
+	if err != nil {
+		return err
+	}
+	return h.Outbox.AddMongo(ctx, ev)
+}
+
+func (h *AIHandler) GetJobs(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	filter := bson.M{"tenant_id": tenantID}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	if priority := c.Query("priority"); priority != "" {
+		filter["priority"] = priority
+	}
+	if batchID := c.Query("batch_id"); batchID != "" {
+		filter["batch_id"] = batchID
+	}
+
+	limit := int64(c.QueryInt("limit", 50))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := h.jobs().Find(context.TODO(), filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch jobs"})
+	}
+
+	jobs := []models.AIJob{}
+	if err = cursor.All(context.TODO(), &jobs); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse jobs"})
+	}
+	for i := range jobs {
+		jobs[i].ImageURL = h.Store.URL(jobs[i].ImageKey)
+	}
+	return c.JSON(jobs)
+}
+
+// findJob loads the job in the URL, scoped to the caller's tenant. When it
+// returns a nil job it has already written the error response, and the
+// returned error is the result of doing so.
+func (h *AIHandler) findJob(c *fiber.Ctx) (*models.AIJob, error) {
+	tenantID := c.Locals("tenant_id").(string)
+
+	var job models.AIJob
+	err := h.jobs().FindOne(context.TODO(), bson.M{"_id": c.Params("id"), "tenant_id": tenantID}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Job not found"})
+	}
+	if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": "Could not fetch job"})
+	}
+	return &job, nil
+}
+
+func (h *AIHandler) GetJob(c *fiber.Ctx) error {
+	job, err := h.findJob(c)
+	if job == nil {
+		return err
+	}
+	// The stored URL may have expired.
+	job.ImageURL = h.Store.URL(job.ImageKey)
+	return c.JSON(job)
 }
@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/queue"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Batch ingestion: many images, one job each, under one batch ---
+
+func (h *AIHandler) batches() *mongo.Collection {
+	return h.Mongo.Collection("ai_batches")
+}
+
+// batchImage is one image of a batch upload, named after its file or its
+// path inside a ZIP archive.
+type batchImage struct {
+	Name string
+	Img  *uploadedImage
+}
+
+// QueueBatch accepts any number of "files" parts, each an image or a ZIP
+// archive of images, and queues one job per image. Files that are not valid
+// images are reported back instead of failing the whole batch.
+func (h *AIHandler) QueueBatch(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+	tenantID := c.Locals("tenant_id").(string)
+
+	priority := c.FormValue("priority", queue.PriorityNameBulk)
+	if _, ok := queue.ParsePriority(priority); !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Priority must be interactive or bulk"})
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["files"]) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": `Missing "files" in multipart form`})
+	}
+
+	var size int64
+	for _, fh := range form.File["files"] {
+		size += fh.Size
+	}
+	if size > h.MaxBatchBytes {
+		return c.Status(413).JSON(fiber.Map{"error": fmt.Sprintf("Batch exceeds %d bytes", h.MaxBatchBytes)})
+	}
+
+	var images []batchImage
+	rejected := []models.AIBatchFile{}
+	for _, fh := range form.File["files"] {
+		if ferr := h.readBatchFile(fh, &images, &rejected); ferr != nil {
+			return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+		}
+	}
+	if len(images) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "No valid images in batch", "rejected": rejected})
+	}
+	if ferr := h.checkInFlight(tenantID, priority, len(images)); ferr != nil {
+		return h.rejectInFlight(c, ferr)
+	}
+
+	batch := models.AIBatch{
+		ID:        uuid.NewString(),
+		TenantID:  tenantID,
+		UserID:    userID,
+		Priority:  priority,
+		Rejected:  rejected,
+		CreatedAt: time.Now(),
+	}
+	if _, err := h.batches().InsertOne(context.TODO(), batch); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create batch"})
+	}
+
+	jobs := []fiber.Map{}
+	var failed []models.AIBatchFile
+	for _, bi := range images {
+		// Earlier images of this batch are already stored, so repeats
+		// within the batch are caught too.
+		hash := hashImage(bi.Img)
+		if prior, _ := h.checkDuplicate(c, tenantID, hash); prior != nil {
+			failed = append(failed, models.AIBatchFile{Name: bi.Name, Error: "Duplicate of job " + prior.ID, DuplicateOf: prior.ID})
+			continue
+		}
+
+		record := models.AIJob{
+			TenantID:  tenantID,
+			UserID:    userID,
+			Priority:  priority,
+			BatchID:   batch.ID,
+			FileName:  bi.Name,
+			ImageHash: hash,
+		}
+		if ferr := h.queueImage(c.Context(), &record, bi.Img); ferr != nil {
+			failed = append(failed, models.AIBatchFile{Name: bi.Name, Error: ferr.Message})
+			continue
+		}
+		jobs = append(jobs, fiber.Map{"job_id": record.ID, "file_name": bi.Name, "status": record.Status})
+	}
+	if len(failed) > 0 {
+		batch.Rejected = append(batch.Rejected, failed...)
+		_, err := h.batches().UpdateOne(context.TODO(), bson.M{"_id": batch.ID},
+			bson.M{"$push": bson.M{"rejected": bson.M{"$each": failed}}})
+		if err != nil {
+			log.Printf("ai: record failed files of batch %s: %v", batch.ID, err)
+		}
+	}
+	if len(jobs) == 0 {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not queue any image", "batch_id": batch.ID, "rejected": batch.Rejected})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":  fmt.Sprintf("%d images queued for processing", len(jobs)),
+		"batch_id": batch.ID,
+		"priority": priority,
+		"jobs":     jobs,
+		"rejected": batch.Rejected,
+	})
+}
+
+// readBatchFile adds the images of one uploaded file to images, expanding
+// ZIP archives. Only a batch that grows past MaxBatchFiles is an error; bad
+// files are added to rejected.
+func (h *AIHandler) readBatchFile(fh *multipart.FileHeader, images *[]batchImage, rejected *[]models.AIBatchFile) *fiber.Error {
+	f, err := fh.Open()
+	if err != nil {
+		*rejected = append(*rejected, models.AIBatchFile{Name: fh.Filename, Error: "Could not read uploaded file"})
+		return nil
+	}
+	defer f.Close()
+
+	zr, err := zip.NewReader(f, fh.Size)
+	if err != nil {
+		// Not an archive: a single image.
+		img, ferr := h.readImageFile(fh)
+		if ferr != nil {
+			*rejected = append(*rejected, models.AIBatchFile{Name: fh.Filename, Error: ferr.Message})
+			return nil
+		}
+		return h.addBatchImage(images, batchImage{Name: fh.Filename, Img: img})
+	}
+
+	for _, zf := range zr.File {
+		name := zf.Name
+		if zf.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+			continue
+		}
+		name = fh.Filename + "/" + name
+		if zf.UncompressedSize64 > uint64(h.MaxImageBytes) {
+			*rejected = append(*rejected, models.AIBatchFile{Name: name, Error: h.tooLarge().Message})
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			*rejected = append(*rejected, models.AIBatchFile{Name: name, Error: "Could not read archive entry"})
+			continue
+		}
+		// readImageData enforces the size limit on the decompressed bytes,
+		// whatever the archive's header claims.
+		img, ferr := h.readImageData(rc)
+		rc.Close()
+		if ferr != nil {
+			*rejected = append(*rejected, models.AIBatchFile{Name: name, Error: ferr.Message})
+			continue
+		}
+		if ferr := h.addBatchImage(images, batchImage{Name: name, Img: img}); ferr != nil {
+			return ferr
+		}
+	}
+	return nil
+}
+
+func (h *AIHandler) addBatchImage(images *[]batchImage, bi batchImage) *fiber.Error {
+	if len(*images) >= h.MaxBatchFiles {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("Batch exceeds %d images", h.MaxBatchFiles))
+	}
+	*images = append(*images, bi)
+	return nil
+}
+
+// batchProgress aggregates the states of a batch's jobs.
+type batchProgress struct {
+	Status   string         `json:"status"` // processing, completed or completed_with_errors
+	Total    int            `json:"total"`
+	Finished int            `json:"finished"`
+	Percent  float64        `json:"percent"`
+	Counts   map[string]int `json:"counts"` // jobs per status
+}
+
+func (p *batchProgress) add(status string, n int) {
+	p.Counts[status] += n
+	p.Total += n
+	for _, s := range models.AIJobOpenStatuses {
+		if s == status {
+			return
+		}
+	}
+	p.Finished += n
+}
+
+func (p *batchProgress) finish() {
+	switch {
+	case p.Finished < p.Total:
+		p.Status = "processing"
+	case p.Counts[models.AIJobSucceeded] == p.Total:
+		p.Status = "completed"
+	default:
+		p.Status = "completed_with_errors"
+	}
+	if p.Total > 0 {
+		p.Percent = float64(p.Finished) * 100 / float64(p.Total)
+	}
+}
+
+// batchProgresses computes the progress of each given batch in one query.
+func (h *AIHandler) batchProgresses(ctx context.Context, tenantID string, batchIDs []string) (map[string]*batchProgress, error) {
+	cursor, err := h.jobs().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"tenant_id": tenantID, "batch_id": bson.M{"$in": batchIDs}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"batch_id": "$batch_id", "status": "$status"},
+			"count": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID struct {
+			BatchID string `bson:"batch_id"`
+			Status  string `bson:"status"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	progress := map[string]*batchProgress{}
+	for _, id := range batchIDs {
+		progress[id] = &batchProgress{Counts: map[string]int{}}
+	}
+	for _, r := range rows {
+		progress[r.ID.BatchID].add(r.ID.Status, r.Count)
+	}
+	for _, p := range progress {
+		p.finish()
+	}
+	return progress, nil
+}
+
+func (h *AIHandler) GetBatches(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	limit := int64(c.QueryInt("limit", 50))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := h.batches().Find(context.TODO(), bson.M{"tenant_id": tenantID}, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch batches"})
+	}
+	batches := []models.AIBatch{}
+	if err = cursor.All(context.TODO(), &batches); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse batches"})
+	}
+
+	ids := make([]string, len(batches))
+	for i, b := range batches {
+		ids[i] = b.ID
+	}
+	progress, err := h.batchProgresses(context.TODO(), tenantID, ids)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not compute batch progress"})
+	}
+
+	out := make([]fiber.Map, len(batches))
+	for i, b := range batches {
+		out[i] = fiber.Map{"batch": b, "progress": progress[b.ID]}
+	}
+	return c.JSON(out)
+}
+
+// findBatch loads the batch in the URL, scoped to the caller's tenant. Like
+// findJob it writes the error response itself when it returns nil.
+func (h *AIHandler) findBatch(c *fiber.Ctx) (*models.AIBatch, error) {
+	tenantID := c.Locals("tenant_id").(string)
+
+	var batch models.AIBatch
+	err := h.batches().FindOne(context.TODO(), bson.M{"_id": c.Params("id"), "tenant_id": tenantID}).Decode(&batch)
+	if err == mongo.ErrNoDocuments {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Batch not found"})
+	}
+	if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": "Could not fetch batch"})
+	}
+	return &batch, nil
+}
+
+// GetBatch returns a batch with its aggregate progress and a summary of each
+// of its jobs.
+func (h *AIHandler) GetBatch(c *fiber.Ctx) error {
+	batch, err := h.findBatch(c)
+	if batch == nil {
+		return err
+	}
+
+	progress, err := h.batchProgresses(context.TODO(), batch.TenantID, []string{batch.ID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not compute batch progress"})
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetProjection(bson.M{"result": 0, "runs": 0, "reviews": 0})
+	cursor, err := h.jobs().Find(context.TODO(), bson.M{"tenant_id": batch.TenantID, "batch_id": batch.ID}, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch batch jobs"})
+	}
+	jobs := []models.AIJob{}
+	if err = cursor.All(context.TODO(), &jobs); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse batch jobs"})
+	}
+
+	return c.JSON(fiber.Map{"batch": batch, "progress": progress[batch.ID], "jobs": jobs})
+}
+
+// draftGroup consolidates the drafts of a batch that describe the same
+// product: same SKU if set, otherwise the same name.
+type draftGroup struct {
+	Name          string        `json:"name"`
+	SKU           string        `json:"sku,omitempty"`
+	TotalQuantity float64       `json:"total_quantity"`
+	MaxConfidence float64       `json:"max_confidence"`
+	Items         []models.Item `json:"items"`
+}
+
+// GetBatchDrafts returns the pending drafts of every job in the batch,
+// consolidated into one line per detected product. Each line keeps its
+// drafts so they can be reviewed through the job detection endpoints.
+func (h *AIHandler) GetBatchDrafts(c *fiber.Ctx) error {
+	batch, err := h.findBatch(c)
+	if batch == nil {
+		return err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := h.Mongo.Collection("items").Find(context.TODO(),
+		bson.M{"tenant_id": batch.TenantID, "batch_id": batch.ID, "status": models.ItemStatusDraft}, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch drafts"})
+	}
+	var items []models.Item
+	if err = cursor.All(context.TODO(), &items); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse drafts"})
+	}
+
+	byKey := map[string]*draftGroup{}
+	groups := []*draftGroup{}
+	for _, item := range items {
+		key := "name:" + strings.ToLower(strings.TrimSpace(item.Name))
+		if item.SKU != "" {
+			key = "sku:" + item.SKU
+		}
+		g, ok := byKey[key]
+		if !ok {
+			g = &draftGroup{Name: item.Name, SKU: item.SKU}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.TotalQuantity += item.Quantity
+		if item.AILog != nil && item.AILog.Confidence > g.MaxConfidence {
+			g.MaxConfidence = item.AILog.Confidence
+		}
+		g.Items = append(g.Items, item)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].TotalQuantity > groups[j].TotalQuantity })
+
+	return c.JSON(fiber.Map{"batch_id": batch.ID, "drafts": len(items), "items": groups})
+}
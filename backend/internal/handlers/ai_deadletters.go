@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/queue"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (h *AIHandler) deadLetters() *mongo.Collection {
+	return h.Mongo.Collection("ai_dead_letters")
+}
+
+// HandleRetry puts a failed job back to queued while it waits out its
+// backoff delay.
+func (h *AIHandler) HandleRetry(ctx context.Context, msg queue.AIJob, attempt int, delay time.Duration) error {
+	now := time.Now()
+	next := now.Add(delay)
+
+	var job models.AIJob
+	err := h.jobs().FindOneAndUpdate(ctx, openRunFilter(msg.JobID, msg.Run),
+		bson.M{"$set": bson.M{
+			"status":          models.AIJobQueued,
+			"attempts":        attempt,
+			"error":           fmt.Sprintf("attempt %d failed, retrying in %s", attempt, delay),
+			"next_attempt_at": next,
+			"updated_at":      now,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+	return h.emitJobUpdate(job, err)
+}
+
+// HandleDeadLetter stores a job that ran out of attempts and fails it.
+func (h *AIHandler) HandleDeadLetter(ctx context.Context, dl queue.DeadLetter) error {
+	now := time.Now()
+	doc := models.AIDeadLetter{
+		Payload:   string(dl.Body),
+		Attempts:  dl.Attempts,
+		Reason:    dl.Reason,
+		CreatedAt: now,
+	}
+	if dl.Job == nil {
+		log.Printf("ai: dead-lettering unparseable message: %s", dl.Body)
+		_, err := h.deadLetters().InsertOne(ctx, doc)
+		return err
+	}
+
+	// Trust the tenant on our own job record over the one in the message.
+	var job models.AIJob
+	if err := h.jobs().FindOne(ctx, bson.M{"_id": dl.Job.JobID}).Decode(&job); err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	doc.TenantID = job.TenantID
+	doc.JobID = dl.Job.JobID
+
+	err := h.Outbox.RunMongo(ctx, func(ctx context.Context) error {
+		// Keyed by job so a redelivered message does not create a second entry.
+		_, err := h.deadLetters().UpdateOne(ctx,
+			bson.M{"job_id": doc.JobID},
+			bson.M{"$set": doc},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+
+		err = h.jobs().FindOneAndUpdate(ctx, openRunFilter(doc.JobID, dl.Job.Run),
+			bson.M{
+				"$set": bson.M{
+					"status":        models.AIJobFailed,
+					"attempts":      dl.Attempts,
+					"dead_lettered": true,
+					"error":         fmt.Sprintf("dead-lettered after %d attempts (%s)", dl.Attempts, dl.Reason),
+					"updated_at":    now,
+					"finished_at":   now,
+				},
+				"$unset": bson.M{"next_attempt_at": ""},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+		if err != nil {
+			return err
+		}
+		if err := h.releaseInFlight(ctx, job); err != nil {
+			return err
+		}
+		return h.Outbox.EmitMongo(ctx, job.TenantID, "ai.job.failed", job)
+	})
+	return h.emitJobUpdate(job, err)
+}
+
+// --- Admin: dead-lettered jobs ---
+
+func (h *AIHandler) GetDeadLetters(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(200)
+	cursor, err := h.deadLetters().Find(context.TODO(), bson.M{"tenant_id": tenantID}, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch dead letters"})
+	}
+	letters := []models.AIDeadLetter{}
+	if err = cursor.All(context.TODO(), &letters); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse dead letters"})
+	}
+	return c.JSON(letters)
+}
+
+func (h *AIHandler) findDeadLetter(c *fiber.Ctx) (*models.AIDeadLetter, error) {
+	tenantID := c.Locals("tenant_id").(string)
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "Invalid dead letter id"})
+	}
+
+	var dl models.AIDeadLetter
+	err = h.deadLetters().FindOne(context.TODO(), bson.M{"_id": id, "tenant_id": tenantID}).Decode(&dl)
+	if err == mongo.ErrNoDocuments {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Dead letter not found"})
+	}
+	if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": "Could not fetch dead letter"})
+	}
+	return &dl, nil
+}
+
+func (h *AIHandler) GetDeadLetter(c *fiber.Ctx) error {
+	dl, err := h.findDeadLetter(c)
+	if dl == nil {
+		return err
+	}
+
+	resp := fiber.Map{"dead_letter": dl}
+	if dl.JobID != "" {
+		var job models.AIJob
+		if err := h.jobs().FindOne(context.TODO(), bson.M{"_id": dl.JobID, "tenant_id": dl.TenantID}).Decode(&job); err == nil {
+			resp["job"] = job
+		}
+	}
+	return c.JSON(resp)
+}
+
+// RequeueDeadLetter queues the job again with a fresh attempt budget. The
+// job takes an in-flight slot again, since dead-lettering gave its slot
+// back.
+func (h *AIHandler) RequeueDeadLetter(c *fiber.Ctx) error {
+	dl, err := h.findDeadLetter(c)
+	if dl == nil {
+		return err
+	}
+
+	var msg queue.AIJob
+	if err := json.Unmarshal([]byte(dl.Payload), &msg); err != nil || msg.JobID == "" {
+		return c.Status(422).JSON(fiber.Map{"error": "Dead letter payload is not a valid job"})
+	}
+
+	var job models.AIJob
+	err = h.jobs().FindOne(context.TODO(), bson.M{"_id": msg.JobID, "tenant_id": dl.TenantID}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(404).JSON(fiber.Map{"error": "Job not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch job"})
+	}
+	if ferr := h.checkInFlight(job.TenantID, job.Priority, 1); ferr != nil {
+		return h.rejectInFlight(c, ferr)
+	}
+
+	err = h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		// Only a job still failed by its dead letter goes back; one that was
+		// re-run or requeued since has its slot already.
+		err := h.jobs().FindOneAndUpdate(ctx,
+			bson.M{"_id": msg.JobID, "tenant_id": dl.TenantID, "status": models.AIJobFailed, "dead_lettered": true},
+			bson.M{
+				"$set":   bson.M{"status": models.AIJobPending, "attempts": 0, "error": "", "updated_at": time.Now()},
+				"$unset": bson.M{"dead_lettered": "", "finished_at": "", "next_attempt_at": ""},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+		if err != nil {
+			return err
+		}
+		if err := h.reserveInFlight(ctx, job.TenantID, job.Priority); err != nil {
+			return err
+		}
+		if err := h.enqueueJob(ctx, job, msg.ImageID); err != nil {
+			return err
+		}
+		_, err = h.deadLetters().DeleteOne(ctx, bson.M{"_id": dl.ID})
+		return err
+	})
+	if err == mongo.ErrNoDocuments {
+		return c.Status(409).JSON(fiber.Map{"error": "Job is no longer dead-lettered"})
+	}
+	if ferr, ok := inFlightError(err); ok {
+		return h.rejectInFlight(c, ferr)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not requeue job"})
+	}
+
+	h.emitJobUpdate(job, nil)
+	return c.JSON(fiber.Map{"message": "Job requeued", "job_id": msg.JobID})
+}
+
+func (h *AIHandler) DeleteDeadLetter(c *fiber.Ctx) error {
+	dl, err := h.findDeadLetter(c)
+	if dl == nil {
+		return err
+	}
+	if _, err := h.deadLetters().DeleteOne(context.TODO(), bson.M{"_id": dl.ID}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not delete dead letter"})
+	}
+	return c.JSON(fiber.Map{"message": "Dead letter deleted"})
+}
+
+// PurgeDeadLetters deletes every dead letter of the caller's tenant.
+func (h *AIHandler) PurgeDeadLetters(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	res, err := h.deadLetters().DeleteMany(context.TODO(), bson.M{"tenant_id": tenantID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not purge dead letters"})
+	}
+	return c.JSON(fiber.Map{"message": "Dead letters purged", "deleted": res.DeletedCount})
+}
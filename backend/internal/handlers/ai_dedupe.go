@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/inventory_ai/backend/internal/imagehash"
+	"github.com/inventory_ai/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Near-duplicate uploads, detected with perceptual hashes ---
+
+// Dedupe modes: what to do when an upload matches a recent one.
+const (
+	DedupeOff   = "off"
+	DedupeReuse = "reuse" // answer with the earlier job instead of queueing
+	DedupeFlag  = "flag"  // refuse with 409 unless the client forces it
+)
+
+const (
+	DefaultDedupeWindow      = 24 * time.Hour
+	DefaultDedupeMaxDistance = 5
+
+	// dedupeScanLimit bounds how many recent jobs an upload is compared to.
+	dedupeScanLimit = 2000
+)
+
+// hashImage returns img's perceptual hash, or "" when it cannot be hashed
+// (e.g. WebP, which has no decoder here); such uploads are never deduped.
+func hashImage(img *uploadedImage) string {
+	h, err := imagehash.Compute(img.Data)
+	if err != nil {
+		if !errors.Is(err, imagehash.ErrUnsupported) {
+			log.Printf("ai: hash %s image: %v", img.ContentType, err)
+		}
+		return ""
+	}
+	return h.String()
+}
+
+// findDuplicate returns the tenant's most similar job within the dedupe
+// window whose image is at most DedupeMaxDistance bits away from hash, or
+// nil. Failed and cancelled jobs do not count: retrying them is legitimate.
+func (h *AIHandler) findDuplicate(ctx context.Context, tenantID, hash string) (*models.AIJob, int, error) {
+	if h.DedupeMode == DedupeOff || hash == "" {
+		return nil, 0, nil
+	}
+	want, err := imagehash.Parse(hash)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(dedupeScanLimit).
+		SetProjection(bson.M{"runs": 0, "reviews": 0})
+	cursor, err := h.jobs().Find(ctx, bson.M{
+		"tenant_id":  tenantID,
+		"image_hash": bson.M{"$exists": true},
+		"status":     bson.M{"$nin": []string{models.AIJobFailed, models.AIJobCancelled}},
+		"created_at": bson.M{"$gte": time.Now().Add(-h.DedupeWindow)},
+	}, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var best *models.AIJob
+	bestDistance := h.DedupeMaxDistance + 1
+	for cursor.Next(ctx) {
+		var job models.AIJob
+		if err := cursor.Decode(&job); err != nil {
+			return nil, 0, err
+		}
+		got, err := imagehash.Parse(job.ImageHash)
+		if err != nil {
+			continue
+		}
+		// Newest first, so ties go to the most recent job.
+		if d := imagehash.Distance(want, got); d < bestDistance {
+			best, bestDistance = &job, d
+		}
+	}
+	return best, bestDistance, cursor.Err()
+}
+
+// checkDuplicate looks for an earlier job with the same image unless the
+// client passed force=true. Lookup errors are logged and treated as no
+// duplicate: dedupe only saves work, it must not block uploads.
+func (h *AIHandler) checkDuplicate(c *fiber.Ctx, tenantID, hash string) (*models.AIJob, int) {
+	if c.FormValue("force") == "true" {
+		return nil, 0
+	}
+	prior, distance, err := h.findDuplicate(context.TODO(), tenantID, hash)
+	if err != nil {
+		log.Printf("ai: duplicate lookup failed: %v", err)
+		return nil, 0
+	}
+	return prior, distance
+}
+
+// respondDuplicate answers an upload that matched prior according to the
+// dedupe mode.
+func (h *AIHandler) respondDuplicate(c *fiber.Ctx, prior *models.AIJob, distance int) error {
+	if h.DedupeMode == DedupeFlag {
+		return c.Status(409).JSON(fiber.Map{
+			"error":        "Image looks like a duplicate of a recent upload; resend with force=true to analyze it anyway",
+			"duplicate_of": prior.ID,
+			"status":       prior.Status,
+			"distance":     distance,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message":   "Image matches a recent upload, returning its job",
+		"duplicate": true,
+		"distance":  distance,
+		"job_id":    prior.ID,
+		"status":    prior.Status,
+		"result":    prior.Result,
+		"image_url": h.Store.URL(prior.ImageKey),
+	})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sseKeepAlive is how often a comment line is sent on idle streams so
+// proxies do not close them.
+const sseKeepAlive = 15 * time.Second
+
+// StreamEvents pushes the tenant's AI job updates as Server-Sent Events.
+// Pass ?job_id= to follow a single job.
+func (h *AIHandler) StreamEvents(c *fiber.Ctx) error {
+	if h.Events == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Event stream unavailable"})
+	}
+
+	tenantID := c.Locals("tenant_id").(string)
+	events, unsubscribe := h.Events.Subscribe(tenantID, c.Query("job_id"))
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // disable nginx response buffering
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		ticker := time.NewTicker(sseKeepAlive)
+		defer ticker.Stop()
+
+		fmt.Fprint(w, "retry: 3000\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case ev := <-events:
+				data, err := json.Marshal(ev)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+			case <-ticker.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			// A failed flush means the client went away.
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/queue"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// --- In-flight caps ---
+//
+// Each tenant has a counter document with its open jobs, in total and at
+// bulk priority. A job takes its slot with a conditional $inc in the
+// transaction that creates or re-runs it, and gives it back in the one
+// that finishes it (result, dead letter or cancellation), so concurrent
+// uploads cannot take the tenant past its caps.
+
+// inFlightCounter is a tenant's document in the ai_inflight collection.
+type inFlightCounter struct {
+	TenantID string `bson:"_id"`
+	Open     int    `bson:"open"`
+	Bulk     int    `bson:"bulk"`
+}
+
+func (h *AIHandler) inFlight() *mongo.Collection {
+	return h.Mongo.Collection("ai_inflight")
+}
+
+// loadInFlight returns the tenant's counter. The first time, it is created
+// from the tenant's open jobs.
+func (h *AIHandler) loadInFlight(ctx context.Context, tenantID string) (inFlightCounter, error) {
+	var counter inFlightCounter
+	err := h.inFlight().FindOne(ctx, bson.M{"_id": tenantID}).Decode(&counter)
+	if err != mongo.ErrNoDocuments {
+		return counter, err
+	}
+
+	filter := bson.M{"tenant_id": tenantID, "status": bson.M{"$in": models.AIJobOpenStatuses}}
+	open, err := h.jobs().CountDocuments(ctx, filter)
+	if err != nil {
+		return counter, err
+	}
+	filter["priority"] = queue.PriorityNameBulk
+	bulk, err := h.jobs().CountDocuments(ctx, filter)
+	if err != nil {
+		return counter, err
+	}
+	counter = inFlightCounter{TenantID: tenantID, Open: int(open), Bulk: int(bulk)}
+	if _, err := h.inFlight().InsertOne(ctx, counter); mongo.IsDuplicateKeyError(err) {
+		// Another request created it first.
+		return h.loadInFlight(ctx, tenantID)
+	} else if err != nil {
+		return counter, err
+	}
+	return counter, nil
+}
+
+// checkInFlight reports whether tenantID may open n more jobs of the given
+// priority without exceeding its in-flight caps. It only looks, so that
+// uploads over the caps are turned away before any work; the slots are
+// taken by reserveInFlight.
+func (h *AIHandler) checkInFlight(tenantID, priority string, n int) *fiber.Error {
+	counter, err := h.loadInFlight(context.TODO(), tenantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not check job limits")
+	}
+	return h.inFlightLimit(counter, priority, n)
+}
+
+// inFlightLimit returns a 429 error when n more jobs of the given priority
+// do not fit next to counter.
+func (h *AIHandler) inFlightLimit(counter inFlightCounter, priority string, n int) *fiber.Error {
+	if counter.Open+n > h.MaxInFlight {
+		return fiber.NewError(fiber.StatusTooManyRequests,
+			fmt.Sprintf("Tenant has %d jobs in flight (limit %d)", counter.Open, h.MaxInFlight))
+	}
+	if priority == queue.PriorityNameBulk && counter.Bulk+n > h.MaxBulkInFlight {
+		return fiber.NewError(fiber.StatusTooManyRequests,
+			fmt.Sprintf("Tenant has %d bulk jobs in flight (limit %d)", counter.Bulk, h.MaxBulkInFlight))
+	}
+	return nil
+}
+
+// reserveInFlight takes a slot for one job of the given priority, inside
+// the transaction that opens the job. The counter must exist, which
+// checkInFlight sees to. At a cap it returns a 429 *fiber.Error.
+func (h *AIHandler) reserveInFlight(ctx context.Context, tenantID, priority string) error {
+	filter := bson.M{"_id": tenantID, "open": bson.M{"$lt": h.MaxInFlight}}
+	inc := bson.M{"open": 1}
+	if priority == queue.PriorityNameBulk {
+		filter["bulk"] = bson.M{"$lt": h.MaxBulkInFlight}
+		inc["bulk"] = 1
+	}
+	res, err := h.inFlight().UpdateOne(ctx, filter, bson.M{"$inc": inc})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 1 {
+		return nil
+	}
+	var counter inFlightCounter
+	if err := h.inFlight().FindOne(ctx, bson.M{"_id": tenantID}).Decode(&counter); err != nil {
+		return err
+	}
+	if ferr := h.inFlightLimit(counter, priority, 1); ferr != nil {
+		return ferr
+	}
+	return fiber.NewError(fiber.StatusTooManyRequests, "Tenant has too many jobs in flight")
+}
+
+// releaseInFlight gives back job's slot, inside the transaction that
+// finishes it.
+func (h *AIHandler) releaseInFlight(ctx context.Context, job models.AIJob) error {
+	inc := bson.M{"open": -1}
+	if job.Priority == queue.PriorityNameBulk {
+		inc["bulk"] = -1
+	}
+	_, err := h.inFlight().UpdateOne(ctx, bson.M{"_id": job.TenantID}, bson.M{"$inc": inc})
+	return err
+}
+
+// inFlightError returns the cap error of reserveInFlight from err, if that
+// is what it is.
+func inFlightError(err error) (*fiber.Error, bool) {
+	var ferr *fiber.Error
+	if errors.As(err, &ferr) && ferr.Code == fiber.StatusTooManyRequests {
+		return ferr, true
+	}
+	return nil, false
+}
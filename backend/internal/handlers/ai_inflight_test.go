@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/outbox"
+	"github.com/inventory_ai/backend/internal/queue"
+)
+
+func TestReserveInFlightHoldsCapUnderConcurrency(t *testing.T) {
+	db := testMongo(t)
+	h := &AIHandler{Mongo: db, Outbox: &outbox.Outbox{Mongo: db}, AIConfig: AIConfig{MaxInFlight: 5, MaxBulkInFlight: 3}}
+	ctx := context.Background()
+
+	if ferr := h.checkInFlight(testTenant, queue.PriorityNameBulk, 1); ferr != nil {
+		t.Fatalf("check: %v", ferr)
+	}
+	reserve := func(priority string) error {
+		return h.Outbox.RunMongo(ctx, func(ctx context.Context) error {
+			return h.reserveInFlight(ctx, testTenant, priority)
+		})
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- reserve(queue.PriorityNameBulk)
+		}()
+	}
+	wg.Wait()
+	close(results)
+	reserved := 0
+	for err := range results {
+		if err == nil {
+			reserved++
+		} else if _, ok := inFlightError(err); !ok {
+			t.Fatalf("reserve: %v", err)
+		}
+	}
+	if reserved != 3 {
+		t.Fatalf("reserved %d bulk slots, want 3", reserved)
+	}
+
+	// Interactive jobs fill the rest of the total cap.
+	for i, want := range []bool{true, true, false} {
+		if err := reserve(queue.PriorityNameInteractive); (err == nil) != want {
+			t.Fatalf("interactive reservation %d: %v", i, err)
+		}
+	}
+
+	// A finished job frees its slot.
+	err := h.Outbox.RunMongo(ctx, func(ctx context.Context) error {
+		return h.releaseInFlight(ctx, models.AIJob{TenantID: testTenant, Priority: queue.PriorityNameBulk})
+	})
+	if err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if err := reserve(queue.PriorityNameBulk); err != nil {
+		t.Fatalf("reserve after release: %v", err)
+	}
+	counter, err := h.loadInFlight(ctx, testTenant)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if counter.Open != 5 || counter.Bulk != 3 {
+		t.Fatalf("counter %+v, want 5 open, 3 bulk", counter)
+	}
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	mongo_models "github.com/inventory_ai/backend/database/mongo"
+	"github.com/inventory_ai/backend/internal/events"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/outbox"
+	"github.com/inventory_ai/backend/internal/queue"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// HandleResult applies a message from the AI worker to its job record.
+// Successful results also create draft items, one per detection. It is safe
+// to call more than once for the same result: terminal jobs are left alone.
+func (h *AIHandler) HandleResult(ctx context.Context, res queue.AIResult) error {
+	now := time.Now()
+	current := openRunFilter(res.JobID, res.Run)
+
+	after := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var job models.AIJob
+	switch res.Status {
+	case models.AIJobProcessing:
+		err := h.jobs().FindOneAndUpdate(ctx,
+			// The worker can beat the relay to marking a fresh job queued.
+			withRun(bson.M{"_id": res.JobID, "status": bson.M{"$in": []string{models.AIJobPending, models.AIJobQueued}}}, res.Run),
+			bson.M{"$set": bson.M{"status": models.AIJobProcessing, "started_at": now, "updated_at": now}},
+			after).Decode(&job)
+		return h.emitJobUpdate(job, err)
+
+	case models.AIJobFailed:
+		err := h.Outbox.RunMongo(ctx, func(ctx context.Context) error {
+			err := h.jobs().FindOneAndUpdate(ctx, current,
+				bson.M{"$set": bson.M{"status": models.AIJobFailed, "error": res.Error, "updated_at": now, "finished_at": now}},
+				after).Decode(&job)
+			if err != nil {
+				return err
+			}
+			if err := h.releaseInFlight(ctx, job); err != nil {
+				return err
+			}
+			return h.Outbox.EmitMongo(ctx, job.TenantID, "ai.job.failed", job)
+		})
+		return h.emitJobUpdate(job, err)
+
+	case models.AIJobSucceeded:
+		result := models.AIJobResult{RawText: res.RawText, Model: res.Model, Detections: []models.AIDetection{}}
+		for _, d := range res.Detections {
+			result.Detections = append(result.Detections, models.AIDetection{
+				Name:       d.Name,
+				Quantity:   d.Quantity,
+				Confidence: d.Confidence,
+			})
+		}
+
+		err := h.jobs().FindOne(ctx, current).Decode(&job)
+		if err == mongo.ErrNoDocuments {
+			// Unknown job, already finished (redelivery), cancelled or
+			// re-run since.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// The drafts, the succeeded job and its event commit together; if
+		// the job is no longer open the transaction aborts and the drafts
+		// go with it.
+		err = h.Outbox.RunMongo(ctx, func(ctx context.Context) error {
+			if err := h.createDraftItems(ctx, job, result, now); err != nil {
+				return err
+			}
+			err := h.jobs().FindOneAndUpdate(ctx, current,
+				bson.M{"$set": bson.M{"status": models.AIJobSucceeded, "result": result, "error": "", "updated_at": now, "finished_at": now}},
+				after).Decode(&job)
+			if err != nil {
+				return err
+			}
+			if err := h.releaseInFlight(ctx, job); err != nil {
+				return err
+			}
+			return h.Outbox.EmitMongo(ctx, job.TenantID, "ai.job.completed", job)
+		})
+		return h.emitJobUpdate(job, err)
+
+	default:
+		log.Printf("ai: ignoring result for job %s with status %q", res.JobID, res.Status)
+		return nil
+	}
+}
+
+// openRunFilter matches jobID while it is open and still on the given run.
+func openRunFilter(jobID string, run int) bson.M {
+	return withRun(bson.M{"_id": jobID, "status": bson.M{"$in": models.AIJobOpenStatuses}}, run)
+}
+
+// withRun restricts filter to a job's current run. Messages from before runs
+// were numbered carry run 0 and match any run.
+func withRun(filter bson.M, run int) bson.M {
+	if run > 0 {
+		filter["run"] = run
+	}
+	return filter
+}
+
+// MarkJobQueued is called by the outbox relay once the broker has confirmed
+// a job message, moving the job from pending to queued.
+func (h *AIHandler) MarkJobQueued(ctx context.Context, ev models.OutboxEvent) {
+	if ev.Type != outbox.JobQueuedEvent {
+		return
+	}
+	var msg queue.AIJob
+	if err := json.Unmarshal([]byte(ev.Payload), &msg); err != nil {
+		return
+	}
+
+	now := time.Now()
+	var job models.AIJob
+	err := h.jobs().FindOneAndUpdate(ctx,
+		withRun(bson.M{"_id": msg.JobID, "status": models.AIJobPending}, msg.Run),
+		bson.M{"$set": bson.M{"status": models.AIJobQueued, "updated_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+	if err := h.emitJobUpdate(job, err); err != nil {
+		log.Printf("ai: mark job %s queued: %v", msg.JobID, err)
+	}
+}
+
+// emitJobUpdate pushes a job's new state to the tenant's connected clients.
+// It takes the error of the update that produced job: no match means the
+// transition did not apply (stale or duplicate message) and is not an error.
+func (h *AIHandler) emitJobUpdate(job models.AIJob, err error) error {
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if h.Events != nil {
+		h.Events.Publish(events.Event{
+			Type:     "ai.job.updated",
+			TenantID: job.TenantID,
+			JobID:    job.ID,
+			Data:     job,
+		})
+	}
+	return nil
+}
+
+// createDraftItems turns each detection into a draft item awaiting review,
+// replacing drafts left behind by an earlier, interrupted attempt.
+func (h *AIHandler) createDraftItems(ctx context.Context, job models.AIJob, result models.AIJobResult, scannedAt time.Time) error {
+	items := h.Mongo.Collection("items")
+	if _, err := items.DeleteMany(ctx, bson.M{"job_id": job.ID, "status": models.ItemStatusDraft}); err != nil {
+		return fmt.Errorf("clear draft items for job %s: %v", job.ID, err)
+	}
+	if len(result.Detections) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, 0, len(result.Detections))
+	for _, d := range result.Detections {
+		item := models.Item{
+			ID:         primitive.NewObjectID(),
+			TenantID:   job.TenantID,
+			Name:       d.Name,
+			Quantity:   d.Quantity,
+			Images:     []string{uploadPath(job.ImageKey)},
+			Attributes: map[string]interface{}{},
+			Status:     models.ItemStatusDraft,
+			Version:    1,
+			JobID:      job.ID,
+			BatchID:    job.BatchID,
+			AILog: &mongo_models.AILog{
+				ScannedAt:  scannedAt,
+				Confidence: d.Confidence,
+				DetectedBy: result.Model,
+				RawOCRText: result.RawText,
+			},
+			CreatedAt: scannedAt,
+			UpdatedAt: scannedAt,
+		}
+		indexItem(&item)
+		docs = append(docs, item)
+	}
+
+	if _, err := items.InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("create draft items for job %s: %v", job.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/units"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Review of AI-detected draft items ---
+
+// draftFilter matches one pending detection of a job.
+func draftFilter(c *fiber.Ctx, job *models.AIJob) (bson.M, bool) {
+	itemID, err := primitive.ObjectIDFromHex(c.Params("itemId"))
+	if err != nil {
+		return nil, false
+	}
+	return bson.M{
+		"_id":       itemID,
+		"tenant_id": job.TenantID,
+		"job_id":    job.ID,
+		"status":    models.ItemStatusDraft,
+	}, true
+}
+
+func (h *AIHandler) GetDetections(c *fiber.Ctx) error {
+	job, err := h.findJob(c)
+	if job == nil {
+		return err
+	}
+
+	filter := bson.M{"tenant_id": job.TenantID, "job_id": job.ID, "status": models.ItemStatusDraft}
+	if c.Query("status") == "all" {
+		delete(filter, "status")
+	}
+
+	cursor, err := h.Mongo.Collection("items").Find(context.TODO(), filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch detections"})
+	}
+	items := []models.Item{}
+	if err = cursor.All(context.TODO(), &items); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse detections"})
+	}
+	return c.JSON(items)
+}
+
+func (h *AIHandler) UpdateDetection(c *fiber.Ctx) error {
+	job, err := h.findJob(c)
+	if job == nil {
+		return err
+	}
+	filter, ok := draftFilter(c, job)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid item id"})
+	}
+
+	var req struct {
+		Name        string   `json:"name"`
+		SKU         string   `json:"sku"`
+		Quantity    *float64 `json:"quantity"`
+		CategoryID  string   `json:"category_id"`
+		WarehouseID string   `json:"warehouse_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	if req.Name != "" {
+		set["name"] = req.Name
+	}
+	if req.SKU != "" {
+		set["sku"] = req.SKU
+	}
+	if req.Quantity != nil {
+		if *req.Quantity < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Quantity cannot be negative"})
+		}
+		set["quantity"] = *req.Quantity
+	}
+	if req.CategoryID != "" {
+		set["category_id"] = req.CategoryID
+	}
+	if req.WarehouseID != "" {
+		set["warehouse_id"] = req.WarehouseID
+	}
+
+	var updated models.Item
+	items := h.Mongo.Collection("items")
+	err = items.FindOneAndUpdate(context.TODO(), filter, bson.M{"$set": set, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(404).JSON(fiber.Map{"error": "Pending detection not found"})
+	}
+	if err == nil {
+		err = reindexItem(context.TODO(), items, &updated)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not update detection"})
+	}
+	return c.JSON(updated)
+}
+
+// ApproveDetection turns a draft into a regular, in-stock item.
+func (h *AIHandler) ApproveDetection(c *fiber.Ctx) error {
+	job, err := h.findJob(c)
+	if job == nil {
+		return err
+	}
+	filter, ok := draftFilter(c, job)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid item id"})
+	}
+
+	var item models.Item
+	err = h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		err := h.Mongo.Collection("items").FindOneAndUpdate(ctx, filter,
+			bson.M{"$set": bson.M{"updated_at": time.Now()}, "$unset": bson.M{"status": ""}, "$inc": bson.M{"version": 1}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&item)
+		if err != nil {
+			return err
+		}
+		if item.Quantity != 0 {
+			err := appendMovement(ctx, h.Mongo, &models.StockMovement{
+				TenantID:    item.TenantID,
+				ItemID:      item.ID,
+				WarehouseID: item.WarehouseID,
+				Type:        models.MovementAIScan,
+				Quantity:    item.Quantity,
+				Balance:     item.Quantity,
+				Reference:   job.ID,
+				UserID:      c.Locals("user_id").(string),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return h.Outbox.EmitMongo(ctx, item.TenantID, "item.created", item)
+	})
+	if err == mongo.ErrNoDocuments {
+		return c.Status(404).JSON(fiber.Map{"error": "Pending detection not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not approve detection"})
+	}
+
+	h.recordReview(c, job, models.AIJobReview{ItemID: item.ID, Action: models.AIReviewApproved, Quantity: item.Quantity})
+	return c.JSON(item)
+}
+
+// MergeDetection adds a draft's quantity to an existing item with the same
+// SKU instead of creating a new one. The item must keep its stock in the
+// draft's unit (409 otherwise).
+func (h *AIHandler) MergeDetection(c *fiber.Ctx) error {
+	job, err := h.findJob(c)
+	if job == nil {
+		return err
+	}
+	filter, ok := draftFilter(c, job)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid item id"})
+	}
+
+	var req struct {
+		SKU string `json:"sku"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	items := h.Mongo.Collection("items")
+	var draft models.Item
+	if err := items.FindOne(context.TODO(), filter).Decode(&draft); err == mongo.ErrNoDocuments {
+		return c.Status(404).JSON(fiber.Map{"error": "Pending detection not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch detection"})
+	}
+
+	sku := req.SKU
+	if sku == "" {
+		sku = draft.SKU
+	}
+	if sku == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "SKU is required to merge"})
+	}
+
+	targetFilter := activeItemFilter(job.TenantID)
+	targetFilter["sku"] = sku
+	if draft.WarehouseID != "" {
+		targetFilter["warehouse_id"] = draft.WarehouseID
+	}
+	// Scans carry no serial numbers, so they cannot add to serialized items.
+	targetFilter["serialized"] = bson.M{"$ne": true}
+
+	now := time.Now()
+	var target models.Item
+	err = h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		// Claiming the draft only while it is one makes two reviewers
+		// merging it at once conflict; the second finds it merged.
+		res, err := items.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"status": models.ItemStatusMerged, "updated_at": now}})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return errNotFound
+		}
+		err = items.FindOne(ctx, targetFilter,
+			options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}})).Decode(&target)
+		if err != nil {
+			return err
+		}
+		// Scans count in the draft's unit; adding them to stock kept in
+		// another would change their meaning.
+		if itemUnit(target) != itemUnit(draft) {
+			return &units.Error{Msg: "Item with SKU " + sku + " keeps stock in " + itemUnit(target) + ", the detection counts " + itemUnit(draft)}
+		}
+		err = items.FindOneAndUpdate(ctx, bson.M{"_id": target.ID},
+			bson.M{"$inc": bson.M{"quantity": draft.Quantity, "version": 1}, "$set": bson.M{"updated_at": now}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&target)
+		if err != nil {
+			return err
+		}
+		if _, err := items.UpdateOne(ctx, bson.M{"_id": draft.ID}, bson.M{"$set": bson.M{"merged_into": target.ID}}); err != nil {
+			return err
+		}
+		err = appendMovement(ctx, h.Mongo, &models.StockMovement{
+			TenantID:    target.TenantID,
+			ItemID:      target.ID,
+			WarehouseID: target.WarehouseID,
+			Type:        models.MovementAIScan,
+			Quantity:    draft.Quantity,
+			Balance:     target.Quantity,
+			Reason:      "merged detection " + draft.ID.Hex(),
+			Reference:   job.ID,
+			UserID:      c.Locals("user_id").(string),
+		})
+		if err != nil {
+			return err
+		}
+		return h.Outbox.EmitMongo(ctx, target.TenantID, "item.updated", target)
+	})
+	if err != nil {
+		if err == errNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Pending detection not found"})
+		}
+		if err == mongo.ErrNoDocuments {
+			return c.Status(404).JSON(fiber.Map{"error": "No existing item with SKU " + sku})
+		}
+		if ue, ok := err.(*units.Error); ok {
+			return c.Status(409).JSON(fiber.Map{"error": ue.Msg})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Could not merge detection"})
+	}
+
+	h.recordReview(c, job, models.AIJobReview{ItemID: draft.ID, Action: models.AIReviewMerged, MergedInto: &target.ID, Quantity: draft.Quantity})
+	return c.JSON(target)
+}
+
+func (h *AIHandler) RejectDetection(c *fiber.Ctx) error {
+	job, err := h.findJob(c)
+	if job == nil {
+		return err
+	}
+	filter, ok := draftFilter(c, job)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid item id"})
+	}
+
+	var item models.Item
+	err = h.Mongo.Collection("items").FindOneAndUpdate(context.TODO(), filter,
+		bson.M{"$set": bson.M{"status": models.ItemStatusRejected, "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(404).JSON(fiber.Map{"error": "Pending detection not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not reject detection"})
+	}
+
+	h.recordReview(c, job, models.AIJobReview{ItemID: item.ID, Action: models.AIReviewRejected, Quantity: item.Quantity})
+	return c.JSON(fiber.Map{"message": "Detection rejected"})
+}
+
+// recordReview appends a decision to the job and stamps reviewed_at once no
+// drafts are left.
+func (h *AIHandler) recordReview(c *fiber.Ctx, job *models.AIJob, review models.AIJobReview) {
+	review.UserID = c.Locals("user_id").(string)
+	review.At = time.Now()
+
+	set := bson.M{"updated_at": review.At}
+	remaining, err := h.Mongo.Collection("items").CountDocuments(context.TODO(),
+		bson.M{"tenant_id": job.TenantID, "job_id": job.ID, "status": models.ItemStatusDraft})
+	if err == nil && remaining == 0 {
+		set["reviewed_at"] = review.At
+	}
+
+	var updated models.AIJob
+	err = h.jobs().FindOneAndUpdate(context.TODO(), bson.M{"_id": job.ID}, bson.M{
+		"$push": bson.M{"reviews": review},
+		"$set":  set,
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	h.emitJobUpdate(updated, err)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/queue"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Cancelling and re-running jobs ---
+
+// modelVersionPattern limits model versions to names the worker can safely
+// resolve to a weights file.
+var modelVersionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// CancelJob stops a job the worker has not started yet. The message stays in
+// the queue; the worker drops it on delivery and any late result is ignored
+// because the job is no longer open.
+func (h *AIHandler) CancelJob(c *fiber.Ctx) error {
+	job, err := h.findJob(c)
+	if job == nil {
+		return err
+	}
+
+	now := time.Now()
+	var cancelled models.AIJob
+	err = h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		err := h.jobs().FindOneAndUpdate(ctx,
+			bson.M{"_id": job.ID, "tenant_id": job.TenantID, "status": bson.M{"$in": models.AIJobCancellableStatuses}},
+			bson.M{
+				"$set":   bson.M{"status": models.AIJobCancelled, "cancelled_at": now, "finished_at": now, "updated_at": now},
+				"$unset": bson.M{"next_attempt_at": ""},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&cancelled)
+		if err != nil {
+			return err
+		}
+		if err := h.releaseInFlight(ctx, cancelled); err != nil {
+			return err
+		}
+		return h.Outbox.EmitMongo(ctx, cancelled.TenantID, "ai.job.cancelled", cancelled)
+	})
+	if err == mongo.ErrNoDocuments {
+		return c.Status(409).JSON(fiber.Map{"error": "Only pending or queued jobs can be cancelled", "status": job.Status})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not cancel job"})
+	}
+
+	if h.Cancellations != nil {
+		if err := h.Cancellations.Cancel(context.TODO(), cancelled.ID, cancelled.Run); err != nil {
+			// The worker will still analyze the image, but its result is
+			// discarded since the job is no longer open.
+			log.Printf("ai: mark job %s cancelled for workers: %v", cancelled.ID, err)
+		}
+	}
+
+	h.emitJobUpdate(cancelled, nil)
+	return c.JSON(cancelled)
+}
+
+// RerunJob analyzes a finished job's stored image again, optionally with a
+// different model version or confidence threshold. The finished run is kept
+// in the job's run history and its unreviewed drafts are discarded.
+func (h *AIHandler) RerunJob(c *fiber.Ctx) error {
+	var req struct {
+		ModelVersion        string   `json:"model_version"`
+		ConfidenceThreshold *float64 `json:"confidence_threshold"`
+		Priority            string   `json:"priority"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+	}
+	if req.ModelVersion != "" && !modelVersionPattern.MatchString(req.ModelVersion) {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid model version"})
+	}
+	if t := req.ConfidenceThreshold; t != nil && (*t <= 0 || *t > 1) {
+		return c.Status(400).JSON(fiber.Map{"error": "Confidence threshold must be in (0, 1]"})
+	}
+
+	job, err := h.findJob(c)
+	if job == nil {
+		return err
+	}
+	for _, s := range models.AIJobOpenStatuses {
+		if job.Status == s {
+			return c.Status(409).JSON(fiber.Map{"error": "Job is still running", "status": job.Status})
+		}
+	}
+
+	// Unset settings carry over from the previous run.
+	modelVersion, threshold, priority := job.ModelVersion, job.ConfidenceThreshold, job.Priority
+	if req.ModelVersion != "" {
+		modelVersion = req.ModelVersion
+	}
+	if req.ConfidenceThreshold != nil {
+		threshold = *req.ConfidenceThreshold
+	}
+	if req.Priority != "" {
+		priority = req.Priority
+	}
+	if _, ok := queue.ParsePriority(priority); !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Priority must be interactive or bulk"})
+	}
+	if ferr := h.checkInFlight(job.TenantID, priority, 1); ferr != nil {
+		return h.rejectInFlight(c, ferr)
+	}
+
+	// Jobs from before runs were numbered are treated as run 1.
+	prev := max(job.Run, 1)
+	archived := models.AIJobRun{
+		Run:                 prev,
+		ModelVersion:        job.ModelVersion,
+		ConfidenceThreshold: job.ConfidenceThreshold,
+		Status:              job.Status,
+		Error:               job.Error,
+		Result:              job.Result,
+		Attempts:            job.Attempts,
+		StartedAt:           job.StartedAt,
+		FinishedAt:          job.FinishedAt,
+	}
+	imageID := job.ImageID
+	if imageID == "" {
+		imageID = "img_" + job.ID
+	}
+
+	var rerun models.AIJob
+	err = h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		// Matching the status we read makes concurrent re-runs of the same
+		// run conflict instead of both enqueueing.
+		err := h.jobs().FindOneAndUpdate(ctx,
+			withRun(bson.M{"_id": job.ID, "tenant_id": job.TenantID, "status": job.Status}, job.Run),
+			bson.M{
+				"$push": bson.M{"runs": archived},
+				"$set": bson.M{
+					"status":               models.AIJobPending,
+					"run":                  prev + 1,
+					"model_version":        modelVersion,
+					"confidence_threshold": threshold,
+					"priority":             priority,
+					"attempts":             0,
+					"error":                "",
+					"updated_at":           time.Now(),
+				},
+				"$unset": bson.M{
+					"result": "", "started_at": "", "finished_at": "", "next_attempt_at": "",
+					"dead_lettered": "", "cancelled_at": "", "reviewed_at": "",
+				},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&rerun)
+		if err != nil {
+			return err
+		}
+		if err := h.reserveInFlight(ctx, rerun.TenantID, rerun.Priority); err != nil {
+			return err
+		}
+		if _, err := h.Mongo.Collection("items").DeleteMany(ctx,
+			bson.M{"tenant_id": job.TenantID, "job_id": job.ID, "status": models.ItemStatusDraft}); err != nil {
+			return err
+		}
+		if _, err := h.deadLetters().DeleteMany(ctx, bson.M{"job_id": job.ID}); err != nil {
+			return err
+		}
+		return h.enqueueJob(ctx, rerun, imageID)
+	})
+	if err == mongo.ErrNoDocuments {
+		return c.Status(409).JSON(fiber.Map{"error": "Job changed while re-running, try again"})
+	}
+	if ferr, ok := inFlightError(err); ok {
+		return h.rejectInFlight(c, ferr)
+	}
+	if err != nil {
+		log.Printf("ai: rerun job %s failed: %v", job.ID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Could not re-run job"})
+	}
+
+	h.emitJobUpdate(rerun, nil)
+	return c.Status(fiber.StatusAccepted).JSON(rerun)
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/inventory_ai/backend/internal/alerts"
+	"github.com/inventory_ai/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Reorder settings and stock alerts ---
+//
+// Items carry a reorder point, a minimum (safety stock) and a maximum (the
+// level to reorder up to). An item lives in one warehouse, so settings are
+// per warehouse; PUT /stock/reorder-settings sets them for a SKU in all
+// warehouses at once. The alerts themselves are kept by alerts.Evaluator.
+
+// checkReorder returns a message for the client unless an item's reorder
+// settings are consistent. Zero turns a setting off.
+func checkReorder(reorderPoint, minQuantity, maxQuantity float64) string {
+	switch {
+	case reorderPoint < 0 || minQuantity < 0 || maxQuantity < 0:
+		return "Reorder settings cannot be negative"
+	case reorderPoint > 0 && minQuantity > reorderPoint:
+		return "Minimum quantity cannot be above the reorder point"
+	case maxQuantity > 0 && (maxQuantity <= reorderPoint || maxQuantity < minQuantity):
+		return "Maximum quantity must be above the reorder point and minimum"
+	}
+	return ""
+}
+
+// reorderRequest is the reorder part of an item update; nil leaves a
+// setting unchanged.
+type reorderRequest struct {
+	ReorderPoint *float64 `json:"reorder_point"`
+	MinQuantity  *float64 `json:"min_quantity"`
+	MaxQuantity  *float64 `json:"max_quantity"`
+}
+
+func (r reorderRequest) empty() bool {
+	return r.ReorderPoint == nil && r.MinQuantity == nil && r.MaxQuantity == nil
+}
+
+// apply checks the settings of item with r applied and adds the changed
+// ones to set. It returns a message for the client when they do not fit.
+func (r reorderRequest) apply(item models.Item, set bson.M) string {
+	if r.ReorderPoint != nil {
+		item.ReorderPoint = *r.ReorderPoint
+		set["reorder_point"] = item.ReorderPoint
+	}
+	if r.MinQuantity != nil {
+		item.MinQuantity = *r.MinQuantity
+		set["min_quantity"] = item.MinQuantity
+	}
+	if r.MaxQuantity != nil {
+		item.MaxQuantity = *r.MaxQuantity
+		set["max_quantity"] = item.MaxQuantity
+	}
+	return checkReorder(item.ReorderPoint, item.MinQuantity, item.MaxQuantity)
+}
+
+// SetReorderSettings sets the reorder settings of a SKU's items, in every
+// warehouse or, with warehouse_id, in one:
+//
+//	{"sku": "SKU-1", "warehouse_id": "...", "reorder_point": 20, "min_quantity": 5, "max_quantity": 100}
+//
+// Settings left out are unchanged.
+func (h *InventoryHandler) SetReorderSettings(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	var req struct {
+		SKU         string `json:"sku"`
+		WarehouseID string `json:"warehouse_id"`
+		reorderRequest
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if req.SKU == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "SKU is required"})
+	}
+	if req.empty() {
+		return c.Status(400).JSON(fiber.Map{"error": "No reorder settings given"})
+	}
+
+	filter := activeItemFilter(tenantID)
+	filter["sku"] = req.SKU
+	if req.WarehouseID != "" {
+		filter["warehouse_id"] = req.WarehouseID
+	}
+	collection := h.Mongo.Collection("items")
+	var items []models.Item
+	cursor, err := collection.Find(context.TODO(), filter)
+	if err == nil {
+		err = cursor.All(context.TODO(), &items)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch items"})
+	}
+	if len(items) == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "No items with SKU " + req.SKU})
+	}
+	sets := make([]bson.M, len(items))
+	for i, item := range items {
+		sets[i] = bson.M{"updated_at": time.Now()}
+		if msg := req.apply(item, sets[i]); msg != "" {
+			return c.Status(400).JSON(fiber.Map{"error": msg, "item_id": item.ID, "warehouse_id": item.WarehouseID})
+		}
+	}
+
+	err = h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		for i := range items {
+			err := collection.FindOneAndUpdate(ctx, bson.M{"_id": items[i].ID},
+				bson.M{"$set": sets[i], "$inc": bson.M{"version": 1}},
+				options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&items[i])
+			if err != nil {
+				return err
+			}
+			if err := h.Outbox.EmitMongo(ctx, tenantID, "item.updated", items[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not update items"})
+	}
+	return c.JSON(items)
+}
+
+// GetAlerts lists the tenant's stock alerts, newest first. By default it
+// lists the unresolved ones; ?status= narrows that to one state (or
+// "resolved" for past alerts) and ?warehouse_id=, ?level= filter further.
+// Counts of unresolved alerts by status come along for badges.
+func (h *InventoryHandler) GetAlerts(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	filter := bson.M{"tenant_id": tenantID, "active": true}
+	switch status := c.Query("status"); status {
+	case "":
+	case models.AlertOpen, models.AlertAcknowledged, models.AlertSnoozed:
+		filter["status"] = status
+	case models.AlertResolved:
+		filter["active"] = false
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid status"})
+	}
+	if v := c.Query("warehouse_id"); v != "" {
+		filter["warehouse_id"] = v
+	}
+	if v := c.Query("level"); v != "" {
+		filter["level"] = v
+	}
+	if v := c.Query("cursor"); v != "" {
+		before, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid cursor"})
+		}
+		filter["_id"] = bson.M{"$lt": before}
+	}
+	limit := c.QueryInt("limit", defaultItemsLimit)
+	if limit <= 0 || limit > maxItemsLimit {
+		limit = defaultItemsLimit
+	}
+
+	cursor, err := alerts.Collection(h.Mongo).Find(context.TODO(), filter,
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit)+1))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch alerts"})
+	}
+	list := []models.StockAlert{}
+	if err = cursor.All(context.TODO(), &list); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse alerts"})
+	}
+	counts, err := h.alertCounts(tenantID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not count alerts"})
+	}
+
+	resp := fiber.Map{"has_more": false, "counts": counts}
+	if len(list) > limit {
+		list = list[:limit]
+		resp["has_more"] = true
+		resp["next_cursor"] = list[len(list)-1].ID.Hex()
+	}
+	resp["alerts"] = list
+	return c.JSON(resp)
+}
+
+// alertCounts counts the tenant's unresolved alerts by status.
+func (h *InventoryHandler) alertCounts(tenantID string) (map[string]int, error) {
+	cursor, err := alerts.Collection(h.Mongo).Aggregate(context.TODO(), mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"tenant_id": tenantID, "active": true}}},
+		{{Key: "$group", Value: bson.M{"_id": "$status", "n": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		Status string `bson:"_id"`
+		N      int    `bson:"n"`
+	}
+	if err := cursor.All(context.TODO(), &groups); err != nil {
+		return nil, err
+	}
+	counts := map[string]int{models.AlertOpen: 0, models.AlertAcknowledged: 0, models.AlertSnoozed: 0}
+	for _, g := range groups {
+		counts[g.Status] = g.N
+	}
+	return counts, nil
+}
+
+// updateAlert applies update to the tenant's unresolved alert in the URL
+// and responds with the result.
+func (h *InventoryHandler) updateAlert(c *fiber.Ctx, set bson.M) error {
+	tenantID := c.Locals("tenant_id").(string)
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid alert id"})
+	}
+	set["updated_at"] = time.Now()
+	update := bson.M{"$set": set}
+	if set["status"] != models.AlertSnoozed {
+		update["$unset"] = bson.M{"snoozed_until": ""}
+	}
+
+	var alert models.StockAlert
+	err = alerts.Collection(h.Mongo).FindOneAndUpdate(context.TODO(),
+		bson.M{"_id": id, "tenant_id": tenantID, "active": true}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&alert)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert not found or already resolved"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not update alert"})
+	}
+	return c.JSON(alert)
+}
+
+// AcknowledgeAlert marks an alert as seen. It stays until the item is
+// restocked, but no longer counts as open unless the item runs out.
+func (h *InventoryHandler) AcknowledgeAlert(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(string)
+	return h.updateAlert(c, bson.M{
+		"status":          models.AlertAcknowledged,
+		"acknowledged_by": userID,
+		"acknowledged_at": time.Now(),
+	})
+}
+
+// SnoozeAlert hides an alert until a time, given as until (RFC 3339) or
+// hours from now:
+//
+//	{"hours": 24}
+//
+// It opens again then if the item is still low.
+func (h *InventoryHandler) SnoozeAlert(c *fiber.Ctx) error {
+	var req struct {
+		Until *time.Time `json:"until"`
+		Hours float64    `json:"hours"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	until := time.Now().Add(time.Duration(req.Hours * float64(time.Hour)))
+	if req.Until != nil {
+		until = *req.Until
+	}
+	if !until.After(time.Now()) {
+		return c.Status(400).JSON(fiber.Map{"error": "Give a time in the future as until or hours"})
+	}
+	return h.updateAlert(c, bson.M{"status": models.AlertSnoozed, "snoozed_until": until})
+}
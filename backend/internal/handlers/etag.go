@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"gorm.io/gorm"
+)
+
+// --- Optimistic concurrency ---
+//
+// Items, warehouses and categories carry a version that every change bumps.
+// Reads send it as the ETag; writes that send If-Match only apply while the
+// version still matches and fail with 412 otherwise. Writes without
+// If-Match apply unconditionally.
+
+// errPreconditionFailed is returned from inside transactions when If-Match
+// does not match the current version.
+var errPreconditionFailed = errors.New("precondition failed")
+
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+func setETag(c *fiber.Ctx, version int) {
+	c.Set(fiber.HeaderETag, etag(version))
+}
+
+// ifMatch returns the versions listed in If-Match, and false when the
+// header is absent or "*" (any version). Tags that are not versions are
+// skipped, so a list of only those matches nothing.
+func ifMatch(c *fiber.Ctx) ([]int, bool) {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return nil, false
+	}
+	versions := []int{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if v, err := strconv.Atoi(strings.Trim(tag, `"`)); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	return versions, true
+}
+
+// preconditionFailed answers a write whose If-Match is stale with the
+// current resource, so the client can merge and retry.
+func preconditionFailed(c *fiber.Ctx, version int, current interface{}) error {
+	setETag(c, version)
+	return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+		"error":   "Modified by someone else",
+		"current": current,
+	})
+}
+
+// versionScope limits a Postgres write to the versions in If-Match.
+func versionScope(c *fiber.Ctx, db *gorm.DB) *gorm.DB {
+	if versions, ok := ifMatch(c); ok {
+		// -1 keeps the list non-empty when no tag was a version.
+		return db.Where("version IN ?", append(versions, -1))
+	}
+	return db
+}
+
+// versionFilter limits a MongoDB write to the versions in If-Match and
+// reports whether it did. Items from before versioning have none, which
+// counts as version 0.
+func versionFilter(c *fiber.Ctx, filter bson.M) bool {
+	versions, ok := ifMatch(c)
+	if !ok {
+		return false
+	}
+	match := bson.A{}
+	for _, v := range versions {
+		match = append(match, v)
+		if v == 0 {
+			match = append(match, nil)
+		}
+	}
+	filter["version"] = bson.M{"$in": match}
+	return true
+}
+
+// checkVersionedWrite turns a write scoped by versionScope that touched no
+// row into errNotFound, or errPreconditionFailed with the current row
+// loaded into current.
+func checkVersionedWrite(tx *gorm.DB, res *gorm.DB, current interface{}, id uuid.UUID, tenantID string) error {
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+	err := tx.Where("id = ? AND tenant_id = ?", id, tenantID).First(current).Error
+	if err == gorm.ErrRecordNotFound {
+		return errNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return errPreconditionFailed
+}
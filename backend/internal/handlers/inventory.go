@@ -2,26 +2,35 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/inventory_ai/backend/internal/alerts"
 	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/outbox"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"gorm.io/gorm"
 )
 
 type InventoryHandler struct {
-	PG    *gorm.DB
-	Mongo *mongo.Database
+	PG     *gorm.DB
+	Mongo  *mongo.Database
+	Outbox *outbox.Outbox
 }
 
-func NewInventoryHandler(pg *gorm.DB, mongo *mongo.Database) *InventoryHandler {
-	return &InventoryHandler{PG: pg, Mongo: mongo}
+func NewInventoryHandler(pg *gorm.DB, mongo *mongo.Database, ob *outbox.Outbox) *InventoryHandler {
+	return &InventoryHandler{PG: pg, Mongo: mongo, Outbox: ob}
 }
 
+// errNotFound is returned from inside transactions when the target row or
+// document does not exist, so the transaction is rolled back.
+var errNotFound = errors.New("not found")
+
 // --- Warehouses ---
 
 func (h *InventoryHandler) CreateWarehouse(c *fiber.Ctx) error {
@@ -32,10 +41,18 @@ func (h *InventoryHandler) CreateWarehouse(c *fiber.Ctx) error {
 	}
 
 	wh.TenantID = uuid.MustParse(tenantID)
-
-	if err := h.PG.Create(&wh).Error; err != nil {
+	wh.Version = 1
+
+	err := h.PG.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&wh).Error; err != nil {
+			return err
+		}
+		return h.Outbox.EmitPG(tx, tenantID, "warehouse.created", wh)
+	})
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not create warehouse"})
 	}
+	setETag(c, wh.Version)
 	return c.JSON(wh)
 }
 
@@ -46,6 +63,25 @@ func (h *InventoryHandler) GetWarehouses(c *fiber.Ctx) error {
 	return c.JSON(warehouses)
 }
 
+func (h *InventoryHandler) GetWarehouse(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	warehouseID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid warehouse id"})
+	}
+
+	var wh models.Warehouse
+	err = h.PG.Where("id = ? AND tenant_id = ?", warehouseID, tenantID).First(&wh).Error
+	if err == gorm.ErrRecordNotFound {
+		return c.Status(404).JSON(fiber.Map{"error": "Warehouse not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch warehouse"})
+	}
+	setETag(c, wh.Version)
+	return c.JSON(wh)
+}
+
 func (h *InventoryHandler) UpdateWarehouse(c *fiber.Ctx) error {
 	tenantID := c.Locals("tenant_id").(string)
 	warehouseIDStr := c.Params("id")
@@ -69,21 +105,31 @@ func (h *InventoryHandler) UpdateWarehouse(c *fiber.Ctx) error {
 	// Allow location to be set to empty string intentionally.
 	updates["location"] = req.Location
 	updates["updated_at"] = time.Now()
+	updates["version"] = gorm.Expr("version + 1")
 
-	res := h.PG.Model(&models.Warehouse{}).
-		Where("id = ? AND tenant_id = ?", warehouseID, tenantID).
-		Updates(updates)
-	if res.Error != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Could not update warehouse"})
-	}
-	if res.RowsAffected == 0 {
+	var wh models.Warehouse
+	err = h.PG.Transaction(func(tx *gorm.DB) error {
+		res := versionScope(c, tx.Model(&models.Warehouse{}).
+			Where("id = ? AND tenant_id = ?", warehouseID, tenantID)).
+			Updates(updates)
+		if err := checkVersionedWrite(tx, res, &wh, warehouseID, tenantID); err != nil {
+			return err
+		}
+		if err := tx.Where("id = ? AND tenant_id = ?", warehouseID, tenantID).First(&wh).Error; err != nil {
+			return err
+		}
+		return h.Outbox.EmitPG(tx, tenantID, "warehouse.updated", wh)
+	})
+	if err == errNotFound {
 		return c.Status(404).JSON(fiber.Map{"error": "Warehouse not found"})
 	}
-
-	var wh models.Warehouse
-	if err := h.PG.Where("id = ? AND tenant_id = ?", warehouseID, tenantID).First(&wh).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch updated warehouse"})
+	if err == errPreconditionFailed {
+		return preconditionFailed(c, wh.Version, wh)
 	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not update warehouse"})
+	}
+	setETag(c, wh.Version)
 	return c.JSON(wh)
 }
 
@@ -95,13 +141,45 @@ func (h *InventoryHandler) DeleteWarehouse(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid warehouse id"})
 	}
 
-	res := h.PG.Where("id = ? AND tenant_id = ?", warehouseID, tenantID).Delete(&models.Warehouse{})
-	if res.Error != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Could not delete warehouse"})
+	// Its locations go with it, so items may not be left in its bins.
+	var binIDs []string
+	err = h.PG.Model(&models.StorageLocation{}).
+		Where("warehouse_id = ? AND tenant_id = ? AND kind = ?", warehouseID, tenantID, models.LocationBin).
+		Pluck("id", &binIDs).Error
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch bins"})
+	}
+	if len(binIDs) > 0 {
+		n, err := h.Mongo.Collection("items").CountDocuments(context.TODO(),
+			bson.M{"tenant_id": tenantID, "bin_id": bson.M{"$in": binIDs}}, options.Count().SetLimit(1))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not check bin contents"})
+		}
+		if n > 0 {
+			return c.Status(409).JSON(fiber.Map{"error": "Bins of the warehouse still have items assigned"})
+		}
 	}
-	if res.RowsAffected == 0 {
+
+	var wh models.Warehouse
+	err = h.PG.Transaction(func(tx *gorm.DB) error {
+		res := versionScope(c, tx.Where("id = ? AND tenant_id = ?", warehouseID, tenantID)).Delete(&models.Warehouse{})
+		if err := checkVersionedWrite(tx, res, &wh, warehouseID, tenantID); err != nil {
+			return err
+		}
+		if err := tx.Where("warehouse_id = ?", warehouseID).Delete(&models.StorageLocation{}).Error; err != nil {
+			return err
+		}
+		return h.Outbox.EmitPG(tx, tenantID, "warehouse.deleted", fiber.Map{"id": warehouseID})
+	})
+	if err == errNotFound {
 		return c.Status(404).JSON(fiber.Map{"error": "Warehouse not found"})
 	}
+	if err == errPreconditionFailed {
+		return preconditionFailed(c, wh.Version, wh)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not delete warehouse"})
+	}
 	return c.JSON(fiber.Map{"message": "Warehouse deleted"})
 }
 
@@ -114,10 +192,18 @@ func (h *InventoryHandler) CreateCategory(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
 	}
 	cat.TenantID = uuid.MustParse(tenantID)
-
-	if err := h.PG.Create(&cat).Error; err != nil {
+	cat.Version = 1
+
+	err := h.PG.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&cat).Error; err != nil {
+			return err
+		}
+		return h.Outbox.EmitPG(tx, tenantID, "category.created", cat)
+	})
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not create category"})
 	}
+	setETag(c, cat.Version)
 	return c.JSON(cat)
 }
 
@@ -128,6 +214,25 @@ func (h *InventoryHandler) GetCategories(c *fiber.Ctx) error {
 	return c.JSON(categories)
 }
 
+func (h *InventoryHandler) GetCategory(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	categoryID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid category id"})
+	}
+
+	var cat models.Category
+	err = h.PG.Where("id = ? AND tenant_id = ?", categoryID, tenantID).First(&cat).Error
+	if err == gorm.ErrRecordNotFound {
+		return c.Status(404).JSON(fiber.Map{"error": "Category not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch category"})
+	}
+	setETag(c, cat.Version)
+	return c.JSON(cat)
+}
+
 func (h *InventoryHandler) UpdateCategory(c *fiber.Ctx) error {
 	tenantID := c.Locals("tenant_id").(string)
 	categoryIDStr := c.Params("id")
@@ -146,20 +251,29 @@ func (h *InventoryHandler) UpdateCategory(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Name is required"})
 	}
 
-	res := h.PG.Model(&models.Category{}).
-		Where("id = ? AND tenant_id = ?", categoryID, tenantID).
-		Updates(map[string]interface{}{"name": req.Name})
-	if res.Error != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Could not update category"})
-	}
-	if res.RowsAffected == 0 {
+	var cat models.Category
+	err = h.PG.Transaction(func(tx *gorm.DB) error {
+		res := versionScope(c, tx.Model(&models.Category{}).
+			Where("id = ? AND tenant_id = ?", categoryID, tenantID)).
+			Updates(map[string]interface{}{"name": req.Name, "version": gorm.Expr("version + 1")})
+		if err := checkVersionedWrite(tx, res, &cat, categoryID, tenantID); err != nil {
+			return err
+		}
+		if err := tx.Where("id = ? AND tenant_id = ?", categoryID, tenantID).First(&cat).Error; err != nil {
+			return err
+		}
+		return h.Outbox.EmitPG(tx, tenantID, "category.updated", cat)
+	})
+	if err == errNotFound {
 		return c.Status(404).JSON(fiber.Map{"error": "Category not found"})
 	}
-
-	var cat models.Category
-	if err := h.PG.Where("id = ? AND tenant_id = ?", categoryID, tenantID).First(&cat).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch updated category"})
+	if err == errPreconditionFailed {
+		return preconditionFailed(c, cat.Version, cat)
 	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not update category"})
+	}
+	setETag(c, cat.Version)
 	return c.JSON(cat)
 }
 
@@ -171,52 +285,223 @@ func (h *InventoryHandler) DeleteCategory(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid category id"})
 	}
 
-	res := h.PG.Where("id = ? AND tenant_id = ?", categoryID, tenantID).Delete(&models.Category{})
-	if res.Error != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Could not delete category"})
-	}
-	if res.RowsAffected == 0 {
+	var cat models.Category
+	err = h.PG.Transaction(func(tx *gorm.DB) error {
+		res := versionScope(c, tx.Where("id = ? AND tenant_id = ?", categoryID, tenantID)).Delete(&models.Category{})
+		if err := checkVersionedWrite(tx, res, &cat, categoryID, tenantID); err != nil {
+			return err
+		}
+		return h.Outbox.EmitPG(tx, tenantID, "category.deleted", fiber.Map{"id": categoryID})
+	})
+	if err == errNotFound {
 		return c.Status(404).JSON(fiber.Map{"error": "Category not found"})
 	}
+	if err == errPreconditionFailed {
+		return preconditionFailed(c, cat.Version, cat)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not delete category"})
+	}
 	return c.JSON(fiber.Map{"message": "Category deleted"})
 }
 
 // --- Items (MongoDB) ---
 
+// activeItemFilter matches a tenant's items that are in stock, leaving out
+// AI drafts and reviewed detections (merged or rejected).
+func activeItemFilter(tenantID string) bson.M {
+	return bson.M{
+		"tenant_id": tenantID,
+		"status":    bson.M{"$in": []interface{}{nil, models.ItemStatusActive}},
+	}
+}
+
 func (h *InventoryHandler) CreateItem(c *fiber.Ctx) error {
 	tenantID := c.Locals("tenant_id").(string)
-	var item models.Item
-	if err := c.BodyParser(&item); err != nil {
+	userID, _ := c.Locals("user_id").(string)
+	// Only the fields a client may set; status, version, job and AI
+	// provenance are the server's.
+	var req struct {
+		WarehouseID  string                 `json:"warehouse_id"`
+		BinID        string                 `json:"bin_id"`
+		CategoryID   string                 `json:"category_id"`
+		Name         string                 `json:"name"`
+		Description  string                 `json:"description"`
+		SKU          string                 `json:"sku"`
+		Quantity     float64                `json:"quantity"`
+		Unit         string                 `json:"unit"`
+		Price        float64                `json:"price"`
+		Images       []string               `json:"images"`
+		Tags         []string               `json:"tags"`
+		Attributes   map[string]interface{} `json:"attributes"`
+		ReorderPoint float64                `json:"reorder_point"`
+		MinQuantity  float64                `json:"min_quantity"`
+		MaxQuantity  float64                `json:"max_quantity"`
+		Serialized   bool                   `json:"serialized"`
+	}
+	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
 	}
+	item := models.Item{
+		WarehouseID:  req.WarehouseID,
+		BinID:        req.BinID,
+		CategoryID:   req.CategoryID,
+		Name:         req.Name,
+		Description:  req.Description,
+		SKU:          req.SKU,
+		Quantity:     req.Quantity,
+		Unit:         req.Unit,
+		Price:        req.Price,
+		Images:       req.Images,
+		Tags:         req.Tags,
+		Attributes:   req.Attributes,
+		ReorderPoint: req.ReorderPoint,
+		MinQuantity:  req.MinQuantity,
+		MaxQuantity:  req.MaxQuantity,
+		Serialized:   req.Serialized,
+		Status:       models.ItemStatusActive,
+	}
+	if item.Quantity < 0 {
+		allowBackorders, err := h.allowsBackorders(tenantID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not load tenant settings"})
+		}
+		if !allowBackorders {
+			return c.Status(400).JSON(fiber.Map{"error": "Quantity cannot be negative"})
+		}
+	}
+	if item.BinID != "" {
+		if msg := h.checkBin(tenantID, item.WarehouseID, item.BinID); msg != "" {
+			return c.Status(400).JSON(fiber.Map{"error": msg})
+		}
+	}
+	if item.Serialized && item.Quantity != 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Serialized items start without stock; receive their units with serial numbers"})
+	}
+	if item.Unit == "" {
+		item.Unit = models.DefaultUnit
+	} else if msg := h.checkUnit(tenantID, item.Unit); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if msg := checkReorder(item.ReorderPoint, item.MinQuantity, item.MaxQuantity); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
 
 	item.TenantID = tenantID
 	item.CreatedAt = time.Now()
 	item.UpdatedAt = time.Now()
 	item.ID = primitive.NewObjectID()
+	item.Version = 1
+	indexItem(&item)
 
 	collection := h.Mongo.Collection("items")
-	_, err := collection.InsertOne(context.TODO(), item)
+	err := h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		if _, err := collection.InsertOne(ctx, item); err != nil {
+			return err
+		}
+		if item.Quantity != 0 {
+			m := &models.StockMovement{
+				TenantID:    tenantID,
+				ItemID:      item.ID,
+				WarehouseID: item.WarehouseID,
+				Type:        models.MovementReceipt,
+				Quantity:    item.Quantity,
+				Balance:     item.Quantity,
+				Reason:      "initial stock",
+				UserID:      userID,
+			}
+			if item.Quantity < 0 {
+				m.Type = models.MovementAdjustment
+			}
+			if err := appendMovement(ctx, h.Mongo, m); err != nil {
+				return err
+			}
+		}
+		return h.Outbox.EmitMongo(ctx, tenantID, "item.created", item)
+	})
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not create item"})
 	}
+	setETag(c, item.Version)
+	return c.JSON(item)
+}
+
+func (h *InventoryHandler) GetItem(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid item id"})
+	}
+
+	var item models.Item
+	err = h.Mongo.Collection("items").FindOne(context.TODO(), bson.M{"_id": itemID, "tenant_id": tenantID}).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(404).JSON(fiber.Map{"error": "Item not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch item"})
+	}
+	setETag(c, item.Version)
 	return c.JSON(item)
 }
 
+// findCurrentItem loads an item after a conditional write on it matched
+// nothing, to tell a stale If-Match from a missing item.
+func (h *InventoryHandler) findCurrentItem(ctx context.Context, tenantID string, itemID primitive.ObjectID) (models.Item, error) {
+	var item models.Item
+	err := h.Mongo.Collection("items").FindOne(ctx, bson.M{"_id": itemID, "tenant_id": tenantID}).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		return item, errNotFound
+	}
+	if err != nil {
+		return item, err
+	}
+	return item, errPreconditionFailed
+}
+
+// GetItems returns one page of the tenant's items; see parseItemQuery for
+// the filters. Pass next_cursor back as cursor (with the same sort) for the
+// following page, and count=true to also get the total matching the filters.
 func (h *InventoryHandler) GetItems(c *fiber.Ctx) error {
 	tenantID := c.Locals("tenant_id").(string)
 	collection := h.Mongo.Collection("items")
 
-	cursor, err := collection.Find(context.TODO(), bson.M{"tenant_id": tenantID})
+	q, err := parseItemQuery(c, tenantID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	cursor, err := collection.Find(context.TODO(), q.pageFilter(), q.findOptions())
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch items"})
 	}
 
-	var items []models.Item
+	items := []models.Item{}
 	if err = cursor.All(context.TODO(), &items); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not parse items"})
 	}
-	return c.JSON(items)
+
+	resp := fiber.Map{"has_more": false}
+	if int64(len(items)) > q.Limit {
+		items = items[:q.Limit]
+		last := items[len(items)-1]
+		next, err := encodeItemCursor(itemCursor{Sort: c.Query("sort", defaultItemsSort), Value: sortValue(last, q.Field), ID: last.ID})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not build cursor"})
+		}
+		resp["has_more"] = true
+		resp["next_cursor"] = next
+	}
+	resp["items"] = items
+
+	if c.QueryBool("count") {
+		total, err := collection.CountDocuments(context.TODO(), q.Filter)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not count items"})
+		}
+		resp["total"] = total
+	}
+	return c.JSON(resp)
 }
 
 func (h *InventoryHandler) UpdateItem(c *fiber.Ctx) error {
@@ -228,15 +513,25 @@ func (h *InventoryHandler) UpdateItem(c *fiber.Ctx) error {
 	}
 
 	var req struct {
-		WarehouseID string                 `json:"warehouse_id"`
-		CategoryID  string                 `json:"category_id"`
-		Name        string                 `json:"name"`
-		Description string                 `json:"description"`
-		SKU         string                 `json:"sku"`
-		Quantity    *int                   `json:"quantity"`
-		Price       *float64               `json:"price"`
-		Images      []string               `json:"images"`
-		Attributes  map[string]interface{} `json:"attributes"`
+		WarehouseID  string                 `json:"warehouse_id"`
+		CategoryID   string                 `json:"category_id"`
+		Name         string                 `json:"name"`
+		Description  string                 `json:"description"`
+		SKU          string                 `json:"sku"`
+		Quantity     *float64               `json:"quantity"`
+		Unit         *string                `json:"unit"`
+		Price        *float64               `json:"price"`
+		Images       []string               `json:"images"`
+		Attributes   map[string]interface{} `json:"attributes"`
+		Tags         []string               `json:"tags"`
+		ReorderPoint *float64               `json:"reorder_point"`
+		MinQuantity  *float64               `json:"min_quantity"`
+		MaxQuantity  *float64               `json:"max_quantity"`
+		Serialized   *bool                  `json:"serialized"`
+		BinID        *string                `json:"bin_id"` // "" takes the item out of its bin
+		// QuantityReason explains a changed quantity in the stock ledger,
+		// where it is recorded as an adjustment (a stock count by default).
+		QuantityReason string `json:"quantity_reason"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
@@ -258,7 +553,15 @@ func (h *InventoryHandler) UpdateItem(c *fiber.Ctx) error {
 		set["sku"] = req.SKU
 	}
 	if req.Quantity != nil {
-		set["quantity"] = *req.Quantity
+		if *req.Quantity < 0 {
+			allowBackorders, err := h.allowsBackorders(tenantID)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Could not load tenant settings"})
+			}
+			if !allowBackorders {
+				return c.Status(400).JSON(fiber.Map{"error": "Quantity cannot be negative"})
+			}
+		}
 	}
 	if req.Price != nil {
 		set["price"] = *req.Price
@@ -269,25 +572,202 @@ func (h *InventoryHandler) UpdateItem(c *fiber.Ctx) error {
 	if req.Attributes != nil {
 		set["attributes"] = req.Attributes
 	}
+	if req.Tags != nil {
+		set["tags"] = req.Tags
+	}
+	reorder := reorderRequest{ReorderPoint: req.ReorderPoint, MinQuantity: req.MinQuantity, MaxQuantity: req.MaxQuantity}
 
 	collection := h.Mongo.Collection("items")
+	if req.Serialized != nil || req.Unit != nil || !reorder.empty() {
+		// Serial units are only registered by movements and stock is kept
+		// in the item's unit, so neither can change while there is stock.
+		// Reorder settings are checked together with the ones kept.
+		var current models.Item
+		err := collection.FindOne(context.TODO(), bson.M{"_id": itemID, "tenant_id": tenantID}).Decode(&current)
+		if err == mongo.ErrNoDocuments {
+			return c.Status(404).JSON(fiber.Map{"error": "Item not found"})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not fetch item"})
+		}
+		stocked := current.Quantity != 0 || req.Quantity != nil && *req.Quantity != 0
+		if req.Serialized != nil && *req.Serialized != current.Serialized {
+			if stocked {
+				return c.Status(409).JSON(fiber.Map{"error": "Serialized can only change while the item has no stock"})
+			}
+			set["serialized"] = *req.Serialized
+		}
+		if req.Unit != nil && *req.Unit != itemUnit(current) {
+			if stocked {
+				return c.Status(409).JSON(fiber.Map{"error": "Unit can only change while the item has no stock"})
+			}
+			if msg := h.checkUnit(tenantID, *req.Unit); msg != "" {
+				return c.Status(400).JSON(fiber.Map{"error": msg})
+			}
+			set["unit"] = *req.Unit
+		}
+		if msg := reorder.apply(current, set); msg != "" {
+			return c.Status(400).JSON(fiber.Map{"error": msg})
+		}
+	}
 	filter := bson.M{"_id": itemID, "tenant_id": tenantID}
-	update := bson.M{"$set": set}
+	conditional := versionFilter(c, filter)
+	// The no-stock check above read the item outside the transaction; the
+	// write checks again, so a receipt in between is not reinterpreted.
+	writeFilter := filter
+	_, unitChange := set["unit"]
+	_, serializedChange := set["serialized"]
+	if unitChange || serializedChange {
+		writeFilter = bson.M{"quantity": 0}
+		for k, v := range filter {
+			writeFilter[k] = v
+		}
+	}
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if req.BinID != nil || req.WarehouseID != "" {
+		binID, msg, err := h.itemBin(tenantID, itemID, req.WarehouseID, req.BinID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not check bin"})
+		}
+		if msg != "" {
+			return c.Status(400).JSON(fiber.Map{"error": msg})
+		}
+		if binID == "" {
+			update["$unset"] = bson.M{"bin_id": ""}
+		} else {
+			set["bin_id"] = binID
+		}
+	}
 
-	res, err := collection.UpdateOne(context.TODO(), filter, update)
+	var updated models.Item
+	err = h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		var before models.Item
+		err := collection.FindOne(ctx, filter).Decode(&before)
+		if err == mongo.ErrNoDocuments && conditional {
+			updated, err = h.findCurrentItem(ctx, tenantID, itemID)
+			return err
+		}
+		if err == mongo.ErrNoDocuments {
+			return errNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if (unitChange || serializedChange) && before.Quantity != 0 {
+			return errItemChanged
+		}
+		if req.Quantity != nil && *req.Quantity != before.Quantity {
+			// A new quantity is a stock count: the difference is applied as
+			// an adjustment, and only while the quantity is still the one
+			// it was worked out from.
+			if before.Serialized {
+				return errSerialsRequired
+			}
+			reason := req.QuantityReason
+			if reason == "" {
+				reason = "stock count"
+			}
+			userID, _ := c.Locals("user_id").(string)
+			counted := bson.M{"quantity": before.Quantity}
+			for k, v := range filter {
+				counted[k] = v
+			}
+			updated, err = applyMovementWith(ctx, h.Mongo, counted, update, &models.StockMovement{
+				Type:     models.MovementAdjustment,
+				Quantity: *req.Quantity - before.Quantity,
+				Reason:   reason,
+				UserID:   userID,
+			})
+			if err == mongo.ErrNoDocuments {
+				return errItemChanged
+			}
+		} else {
+			err = collection.FindOneAndUpdate(ctx, writeFilter, update,
+				options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+			if err == mongo.ErrNoDocuments {
+				return errItemChanged
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if err := reindexItem(ctx, collection, &updated); err != nil {
+			return err
+		}
+		if err := h.Outbox.EmitMongo(ctx, tenantID, "item.updated", updated); err != nil {
+			return err
+		}
+		return h.emitLowStock(ctx, before, updated)
+	})
+	if err == errNotFound {
+		return c.Status(404).JSON(fiber.Map{"error": "Item not found"})
+	}
+	if err == errPreconditionFailed {
+		return preconditionFailed(c, updated.Version, updated)
+	}
+	if err == errSerialsRequired {
+		return c.Status(409).JSON(fiber.Map{"error": "Stock of serialized items changes through movements with serial numbers"})
+	}
+	if err == errItemChanged {
+		return c.Status(409).JSON(fiber.Map{"error": "Item changed while it was being updated; try again"})
+	}
+	if err == errInsufficientLot {
+		return c.Status(409).JSON(fiber.Map{"error": "Insufficient stock in lots"})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not update item"})
 	}
-	if res.MatchedCount == 0 {
-		return c.Status(404).JSON(fiber.Map{"error": "Item not found"})
-	}
+	setETag(c, updated.Version)
+	return c.JSON(updated)
+}
 
-	var updated models.Item
-	err = collection.FindOne(context.TODO(), filter).Decode(&updated)
+// itemBin works out the bin of an item being updated with the given
+// warehouse and bin (each empty or nil if unchanged). Moving an item to
+// another warehouse takes it out of its bin unless a new one is given.
+func (h *InventoryHandler) itemBin(tenantID string, itemID primitive.ObjectID, warehouseID string, binID *string) (string, string, error) {
+	var current models.Item
+	err := h.Mongo.Collection("items").FindOne(context.TODO(), bson.M{"_id": itemID, "tenant_id": tenantID}).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		// Let the update report the missing item.
+		return "", "", nil
+	}
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch updated item"})
+		return "", "", err
 	}
-	return c.JSON(updated)
+
+	if warehouseID == "" {
+		warehouseID = current.WarehouseID
+	}
+	bin := current.BinID
+	if binID != nil {
+		bin = *binID
+	} else if warehouseID != current.WarehouseID {
+		bin = ""
+	}
+	if bin == "" || (bin == current.BinID && warehouseID == current.WarehouseID) {
+		return bin, "", nil
+	}
+	return bin, h.checkBin(tenantID, warehouseID, bin), nil
+}
+
+// isLowStock reports whether an item is at or below its reorder point, or
+// its minimum when it has none.
+func isLowStock(item models.Item) bool {
+	return alerts.Level(item) != ""
+}
+
+// emitLowStock emits item.low_stock when a change takes an item from
+// sufficient to low stock, so subscribers hear about it once per dip.
+func (h *InventoryHandler) emitLowStock(ctx context.Context, before, after models.Item) error {
+	if isLowStock(before) || !isLowStock(after) {
+		return nil
+	}
+	return h.Outbox.EmitMongo(ctx, after.TenantID, "item.low_stock", fiber.Map{
+		"item":          after,
+		"quantity":      after.Quantity,
+		"reorder_point": after.ReorderPoint,
+	})
 }
 
 func (h *InventoryHandler) DeleteItem(c *fiber.Ctx) error {
@@ -299,13 +779,32 @@ func (h *InventoryHandler) DeleteItem(c *fiber.Ctx) error {
 	}
 
 	collection := h.Mongo.Collection("items")
-	res, err := collection.DeleteOne(context.TODO(), bson.M{"_id": itemID, "tenant_id": tenantID})
+	filter := bson.M{"_id": itemID, "tenant_id": tenantID}
+	conditional := versionFilter(c, filter)
+
+	var current models.Item
+	err = h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		res, err := collection.DeleteOne(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 && conditional {
+			current, err = h.findCurrentItem(ctx, tenantID, itemID)
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return errNotFound
+		}
+		return h.Outbox.EmitMongo(ctx, tenantID, "item.deleted", fiber.Map{"id": itemID})
+	})
+	if err == errNotFound {
+		return c.Status(404).JSON(fiber.Map{"error": "Item not found"})
+	}
+	if err == errPreconditionFailed {
+		return preconditionFailed(c, current.Version, current)
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not delete item"})
 	}
-	if res.DeletedCount == 0 {
-		return c.Status(404).JSON(fiber.Map{"error": "Item not found"})
-	}
 	return c.JSON(fiber.Map{"message": "Item deleted"})
 }
-
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/inventory_ai/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Item listing: filters, sorting and cursor pagination ---
+
+const (
+	defaultItemsLimit = 50
+	maxItemsLimit     = 200
+	defaultItemsSort  = "-updated_at"
+)
+
+// itemSortFields are the fields GET /items can sort by; each has an index.
+var itemSortFields = map[string]bool{
+	"name":       true,
+	"sku":        true,
+	"quantity":   true,
+	"price":      true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// EnsureIndexes creates the item indexes behind GetItems: one per sort
+// field, with _id as the pagination tie-breaker, plus the common filters
+// the search trigrams and bins.
+func (h *InventoryHandler) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "warehouse_id", Value: 1}, {Key: "updated_at", Value: -1}}},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "category_id", Value: 1}, {Key: "updated_at", Value: -1}}},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "sku", Value: 1}}},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "search_grams", Value: 1}}},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "bin_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+	}
+	for field := range itemSortFields {
+		indexes = append(indexes, mongo.IndexModel{
+			Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: field, Value: 1}, {Key: "_id", Value: 1}},
+		})
+	}
+	_, err := h.Mongo.Collection("items").Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// itemCursor is the position after the last item of a page: its sort value
+// and id. It is BSON-encoded so the value keeps its type.
+type itemCursor struct {
+	Sort  string             `bson:"s"`
+	Value interface{}        `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+func encodeItemCursor(cur itemCursor) (string, error) {
+	raw, err := bson.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeItemCursor(s string) (itemCursor, error) {
+	var cur itemCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cur, err
+	}
+	err = bson.Unmarshal(raw, &cur)
+	return cur, err
+}
+
+// itemQuery is a parsed GET /items request.
+type itemQuery struct {
+	Filter bson.M
+	Field  string // sort field
+	Desc   bool
+	Limit  int64
+	Cursor *itemCursor
+}
+
+// parseItemQuery reads filters, sort, limit and cursor from the query
+// string. Supported filters:
+//
+//	warehouse_id, category_id     exact match
+//	sku                           exact match, comma-separated for several
+//	min_quantity, max_quantity    inclusive range
+//	min_price, max_price          inclusive range
+//	has_attributes=a,b            items that have all these attribute keys
+//	attr.<key>=<value>            attribute equality
+//	updated_after, updated_before RFC 3339 timestamps
+func parseItemQuery(c *fiber.Ctx, tenantID string) (*itemQuery, error) {
+	q := &itemQuery{Filter: activeItemFilter(tenantID), Limit: defaultItemsLimit}
+	f := q.Filter
+
+	if v := c.Query("warehouse_id"); v != "" {
+		f["warehouse_id"] = v
+	}
+	if v := c.Query("category_id"); v != "" {
+		f["category_id"] = v
+	}
+	if v := c.Query("sku"); v != "" {
+		if skus := strings.Split(v, ","); len(skus) > 1 {
+			f["sku"] = bson.M{"$in": skus}
+		} else {
+			f["sku"] = v
+		}
+	}
+	if err := rangeFilter(c, f, "quantity", "min_quantity", "max_quantity"); err != nil {
+		return nil, err
+	}
+	if err := rangeFilter(c, f, "price", "min_price", "max_price"); err != nil {
+		return nil, err
+	}
+	if v := c.Query("has_attributes"); v != "" {
+		for _, key := range strings.Split(v, ",") {
+			if err := checkAttributeKey(key); err != nil {
+				return nil, err
+			}
+			f["attributes."+key] = bson.M{"$exists": true}
+		}
+	}
+	for key, value := range c.Queries() {
+		if attr, ok := strings.CutPrefix(key, "attr."); ok {
+			if err := checkAttributeKey(attr); err != nil {
+				return nil, err
+			}
+			f["attributes."+attr] = attributeValue(value)
+		}
+	}
+
+	updated := bson.M{}
+	for param, op := range map[string]string{"updated_after": "$gte", "updated_before": "$lt"} {
+		if v := c.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", param)
+			}
+			updated[op] = t
+		}
+	}
+	if len(updated) > 0 {
+		f["updated_at"] = updated
+	}
+
+	sort := c.Query("sort", defaultItemsSort)
+	q.Field, q.Desc = strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+	if !itemSortFields[q.Field] {
+		return nil, fmt.Errorf("cannot sort by %q", q.Field)
+	}
+
+	if limit := c.QueryInt("limit", defaultItemsLimit); limit > 0 && limit <= maxItemsLimit {
+		q.Limit = int64(limit)
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		cur, err := decodeItemCursor(v)
+		if err != nil || cur.Sort != sort {
+			return nil, fmt.Errorf("invalid cursor for this sort")
+		}
+		q.Cursor = &cur
+	}
+	return q, nil
+}
+
+func rangeFilter(c *fiber.Ctx, f bson.M, field, minParam, maxParam string) error {
+	r := bson.M{}
+	for param, op := range map[string]string{minParam: "$gte", maxParam: "$lte"} {
+		if v := c.Query(param); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("%s must be a number", param)
+			}
+			r[op] = n
+		}
+	}
+	if len(r) > 0 {
+		f[field] = r
+	}
+	return nil
+}
+
+// checkAttributeKey keeps attribute keys from reaching into operators or
+// nested paths.
+func checkAttributeKey(key string) error {
+	if key == "" || strings.ContainsAny(key, ".$") {
+		return fmt.Errorf("invalid attribute key %q", key)
+	}
+	return nil
+}
+
+// attributeValue matches an attribute given as text against both its string
+// and, where it parses, its numeric or boolean form.
+func attributeValue(v string) interface{} {
+	values := []interface{}{v}
+	if n, err := strconv.ParseFloat(v, 64); err == nil {
+		values = append(values, n)
+	}
+	if b, err := strconv.ParseBool(v); err == nil {
+		values = append(values, b)
+	}
+	if len(values) == 1 {
+		return v
+	}
+	return bson.M{"$in": values}
+}
+
+// pageFilter adds the keyset condition that starts after the cursor.
+func (q *itemQuery) pageFilter() bson.M {
+	if q.Cursor == nil {
+		return q.Filter
+	}
+	op := "$gt"
+	if q.Desc {
+		op = "$lt"
+	}
+	after := bson.M{"$or": bson.A{
+		bson.M{q.Field: bson.M{op: q.Cursor.Value}},
+		bson.M{q.Field: q.Cursor.Value, "_id": bson.M{op: q.Cursor.ID}},
+	}}
+	return bson.M{"$and": bson.A{q.Filter, after}}
+}
+
+func (q *itemQuery) findOptions() *options.FindOptions {
+	dir := 1
+	if q.Desc {
+		dir = -1
+	}
+	// One extra item tells whether there is a next page.
+	return options.Find().
+		SetSort(bson.D{{Key: q.Field, Value: dir}, {Key: "_id", Value: dir}}).
+		SetLimit(q.Limit + 1)
+}
+
+// sortValue returns item's value of the sort field, as stored.
+func sortValue(item models.Item, field string) interface{} {
+	switch field {
+	case "name":
+		return item.Name
+	case "sku":
+		return item.SKU
+	case "quantity":
+		return item.Quantity
+	case "price":
+		return item.Price
+	case "created_at":
+		return item.CreatedAt
+	default:
+		return item.UpdatedAt
+	}
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Item search ---
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+
+	// searchCandidates caps how many items sharing the most trigrams with
+	// the query are ranked for one search.
+	searchCandidates = 500
+)
+
+// itemSearchFields returns the text of an item that search looks at, with
+// the weight of a match in each.
+func itemSearchFields(item models.Item) []search.Field {
+	fields := []search.Field{
+		{Name: "name", Text: item.Name, Weight: 5},
+		{Name: "sku", Text: item.SKU, Weight: 4},
+		{Name: "tags", Text: strings.Join(item.Tags, ", "), Weight: 3},
+		{Name: "attributes", Text: attributesText(item.Attributes), Weight: 2},
+		{Name: "description", Text: item.Description, Weight: 1},
+	}
+	if item.AILog != nil {
+		fields = append(fields, search.Field{Name: "ocr_text", Text: item.AILog.RawOCRText, Weight: 1})
+	}
+	return fields
+}
+
+// attributesText renders attributes as "key: value" pairs in key order.
+func attributesText(attrs map[string]interface{}) string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %v", k, attrs[k]))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// indexItem refreshes the search trigrams stored on item. Call it before
+// inserting an item, or use reindexItem after changing one in place.
+func indexItem(item *models.Item) {
+	item.SearchGrams = search.Grams(itemSearchFields(*item)...)
+}
+
+// reindexItem stores fresh search trigrams for an item that has just been
+// updated.
+func reindexItem(ctx context.Context, items *mongo.Collection, item *models.Item) error {
+	indexItem(item)
+	_, err := items.UpdateOne(ctx, bson.M{"_id": item.ID}, bson.M{"$set": bson.M{"search_grams": item.SearchGrams}})
+	return err
+}
+
+// BackfillSearchIndex indexes items stored before search existed, or
+// written by anything that bypasses the handlers.
+func (h *InventoryHandler) BackfillSearchIndex(ctx context.Context) error {
+	items := h.Mongo.Collection("items")
+	cursor, err := items.Find(ctx, bson.M{"search_grams": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	n := 0
+	for cursor.Next(ctx) {
+		var item models.Item
+		if err := cursor.Decode(&item); err != nil {
+			return err
+		}
+		if err := reindexItem(ctx, items, &item); err != nil {
+			return err
+		}
+		n++
+	}
+	if n > 0 {
+		log.Printf("Search: indexed %d items", n)
+	}
+	return cursor.Err()
+}
+
+type itemSearchHit struct {
+	Item       models.Item       `json:"item"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// SearchItems finds items matching q across name, SKU, tags, attributes,
+// description and AI OCR text, best first. Words may contain a typo or two
+// and match as prefixes. The GetItems filters (warehouse_id, sku,
+// min_quantity, ...) narrow the search.
+func (h *InventoryHandler) SearchItems(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	query := search.ParseQuery(c.Query("q"))
+	if len(query.Terms) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "q is required"})
+	}
+	iq, err := parseItemQuery(c, tenantID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	limit := c.QueryInt("limit", defaultSearchLimit)
+	if limit <= 0 || limit > maxSearchLimit {
+		limit = defaultSearchLimit
+	}
+
+	grams := query.Grams()
+	filter := iq.Filter
+	filter["search_grams"] = bson.M{"$in": grams}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$addFields", Value: bson.M{
+			"_overlap": bson.M{"$size": bson.M{"$setIntersection": bson.A{"$search_grams", grams}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_overlap", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: searchCandidates}},
+		{{Key: "$project", Value: bson.M{"search_grams": 0, "_overlap": 0}}},
+	}
+	cursor, err := h.Mongo.Collection("items").Aggregate(context.TODO(), pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not search items"})
+	}
+	candidates := []models.Item{}
+	if err = cursor.All(context.TODO(), &candidates); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse items"})
+	}
+
+	hits := []itemSearchHit{}
+	for _, item := range candidates {
+		m := query.Score(itemSearchFields(item)...)
+		if m.Score > 0 {
+			hits = append(hits, itemSearchHit{Item: item, Score: m.Score, Highlights: m.Highlights})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return c.JSON(fiber.Map{"query": c.Query("q"), "items": hits})
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/inventory_ai/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// searchItems runs GET /items/search?q=query&limit=100 as the test tenant
+// and returns the names of the hits, best first.
+func searchItems(t *testing.T, h *InventoryHandler, query string) []string {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/items/search", func(c *fiber.Ctx) error {
+		c.Locals("tenant_id", testTenant)
+		return c.Next()
+	}, h.SearchItems)
+	resp, err := app.Test(httptest.NewRequest("GET", "/items/search?limit=100&q="+query, nil), 10000)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("search: status %d", resp.StatusCode)
+	}
+	var body struct {
+		Items []itemSearchHit `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	names := make([]string, len(body.Items))
+	for i, hit := range body.Items {
+		names[i] = hit.Item.Name
+	}
+	return names
+}
+
+// TestSearchItemsCandidateCap fills the index with more than
+// searchCandidates weak matches. Candidates are the items sharing the most
+// trigrams with the query, ties by id, so a stronger match that shares no
+// more trigrams than they do is only ranked once it is among the first
+// searchCandidates.
+func TestSearchItemsCandidateCap(t *testing.T) {
+	db := testMongo(t)
+	h := &InventoryHandler{Mongo: db}
+	ctx := context.Background()
+
+	newItem := func(name, description string) interface{} {
+		item := models.Item{
+			ID:          primitive.NewObjectID(),
+			TenantID:    testTenant,
+			Name:        name,
+			Description: description,
+			Status:      models.ItemStatusActive,
+			CreatedAt:   time.Now(),
+		}
+		indexItem(&item)
+		return item
+	}
+	// "wash" in the description: the same trigrams as "washing" below,
+	// but a fifth of its weight.
+	noise := searchCandidates + 20
+	var docs []interface{}
+	for i := 0; i < noise; i++ {
+		docs = append(docs, newItem(fmt.Sprintf("Part %d", i), "wash"))
+	}
+	docs = append(docs, newItem("Wash tub", ""), newItem("Washing machine", ""))
+	if _, err := db.Collection("items").InsertMany(ctx, docs); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	hits := searchItems(t, h, "wash%20tub")
+	if len(hits) != 100 {
+		t.Fatalf("%d hits, want the limit of 100", len(hits))
+	}
+	if hits[0] != "Wash tub" {
+		t.Fatalf("first hit %q, want the item sharing the most trigrams", hits[0])
+	}
+	for _, name := range hits {
+		if name == "Washing machine" {
+			t.Fatal("ranked an item from beyond the candidate cap")
+		}
+	}
+
+	// With fewer items matching than the cap, it ranks next.
+	var drop []primitive.ObjectID
+	for _, d := range docs[:noise-searchCandidates+2] {
+		drop = append(drop, d.(models.Item).ID)
+	}
+	if _, err := db.Collection("items").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": drop}}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	hits = searchItems(t, h, "wash%20tub")
+	if len(hits) < 2 || hits[0] != "Wash tub" || hits[1] != "Washing machine" {
+		t.Fatalf("hits start %q, want Wash tub then Washing machine", hits[:min(len(hits), 2)])
+	}
+}
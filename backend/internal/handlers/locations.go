@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/inventory_ai/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+)
+
+// --- Storage locations: zones, aisles, racks and bins ---
+
+// errLocationExists is returned from inside transactions when a location's
+// new path is already taken.
+var errLocationExists = errors.New("location exists")
+
+// parentKind returns the kind a location of kind must sit under; "" for
+// zones, which sit directly under the warehouse.
+func parentKind(kind string) (string, bool) {
+	for i, k := range models.LocationKinds {
+		if k == kind {
+			if i == 0 {
+				return "", true
+			}
+			return models.LocationKinds[i-1], true
+		}
+	}
+	return "", false
+}
+
+// checkLocationCode returns a message for the client when code cannot be
+// part of a path.
+func checkLocationCode(code string) string {
+	if code == "" {
+		return "Code is required"
+	}
+	if strings.Contains(code, "/") {
+		return "Code cannot contain /"
+	}
+	return ""
+}
+
+func (h *InventoryHandler) CreateLocation(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	warehouseID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid warehouse id"})
+	}
+
+	var req struct {
+		ParentID *uuid.UUID `json:"parent_id"`
+		Kind     string     `json:"kind"`
+		Code     string     `json:"code"`
+		Name     string     `json:"name"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	req.Code = strings.TrimSpace(req.Code)
+	if msg := checkLocationCode(req.Code); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	wantParent, ok := parentKind(req.Kind)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Kind must be zone, aisle, rack or bin"})
+	}
+
+	var n int64
+	h.PG.Model(&models.Warehouse{}).Where("id = ? AND tenant_id = ?", warehouseID, tenantID).Count(&n)
+	if n == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Warehouse not found"})
+	}
+
+	loc := models.StorageLocation{
+		TenantID:    uuid.MustParse(tenantID),
+		WarehouseID: warehouseID,
+		Kind:        req.Kind,
+		Code:        req.Code,
+		Name:        req.Name,
+		Path:        req.Code,
+	}
+	switch {
+	case wantParent == "" && req.ParentID != nil:
+		return c.Status(400).JSON(fiber.Map{"error": "Zones cannot have a parent"})
+	case wantParent != "" && req.ParentID == nil:
+		return c.Status(400).JSON(fiber.Map{"error": "A " + req.Kind + " needs a parent " + wantParent})
+	case req.ParentID != nil:
+		var parent models.StorageLocation
+		err := h.PG.Where("id = ? AND warehouse_id = ?", *req.ParentID, warehouseID).First(&parent).Error
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(400).JSON(fiber.Map{"error": "Parent location not found in this warehouse"})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not fetch parent location"})
+		}
+		if parent.Kind != wantParent {
+			return c.Status(400).JSON(fiber.Map{"error": "A " + req.Kind + " must be inside a " + wantParent})
+		}
+		loc.ParentID = &parent.ID
+		loc.Path = parent.Path + "/" + req.Code
+	}
+
+	if h.locationPathTaken(h.PG, warehouseID, loc.Path) {
+		return c.Status(409).JSON(fiber.Map{"error": "Location " + loc.Path + " already exists"})
+	}
+	if err := h.PG.Create(&loc).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create location"})
+	}
+	return c.Status(201).JSON(loc)
+}
+
+func (h *InventoryHandler) locationPathTaken(db *gorm.DB, warehouseID uuid.UUID, path string) bool {
+	var n int64
+	db.Model(&models.StorageLocation{}).Where("warehouse_id = ? AND path = ?", warehouseID, path).Count(&n)
+	return n > 0
+}
+
+// GetLocations lists a warehouse's locations in path order, so each one
+// follows its parent; kind and parent_id narrow the list.
+func (h *InventoryHandler) GetLocations(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	warehouseID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid warehouse id"})
+	}
+
+	query := h.PG.Where("warehouse_id = ? AND tenant_id = ?", warehouseID, tenantID).Order("path")
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if parent := c.Query("parent_id"); parent != "" {
+		query = query.Where("parent_id = ?", parent)
+	}
+	locations := []models.StorageLocation{}
+	if err := query.Find(&locations).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch locations"})
+	}
+	return c.JSON(locations)
+}
+
+// findLocation loads the location in the URL, scoped to the caller's
+// tenant. When it returns nil it has already written the error response.
+func (h *InventoryHandler) findLocation(c *fiber.Ctx) (*models.StorageLocation, error) {
+	tenantID := c.Locals("tenant_id").(string)
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "Invalid location id"})
+	}
+	var loc models.StorageLocation
+	err = h.PG.Where("id = ? AND tenant_id = ?", id, tenantID).First(&loc).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Location not found"})
+	}
+	if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": "Could not fetch location"})
+	}
+	return &loc, nil
+}
+
+func (h *InventoryHandler) GetLocation(c *fiber.Ctx) error {
+	loc, err := h.findLocation(c)
+	if loc == nil {
+		return err
+	}
+	return c.JSON(loc)
+}
+
+// UpdateLocation renames a location. A new code changes its path and the
+// paths of everything inside it.
+func (h *InventoryHandler) UpdateLocation(c *fiber.Ctx) error {
+	loc, err := h.findLocation(c)
+	if loc == nil {
+		return err
+	}
+
+	var req struct {
+		Code *string `json:"code"`
+		Name *string `json:"name"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if req.Name != nil {
+		loc.Name = *req.Name
+	}
+
+	oldPath := loc.Path
+	if req.Code != nil && strings.TrimSpace(*req.Code) != loc.Code {
+		code := strings.TrimSpace(*req.Code)
+		if msg := checkLocationCode(code); msg != "" {
+			return c.Status(400).JSON(fiber.Map{"error": msg})
+		}
+		loc.Code = code
+		loc.Path = oldPath[:strings.LastIndex(oldPath, "/")+1] + code
+	}
+
+	err = h.PG.Transaction(func(tx *gorm.DB) error {
+		if loc.Path != oldPath {
+			if h.locationPathTaken(tx, loc.WarehouseID, loc.Path) {
+				return errLocationExists
+			}
+			// Descendants keep their own codes under the new prefix.
+			err := tx.Exec(`UPDATE storage_locations SET path = ? || substr(path, ?), updated_at = now()
+				WHERE warehouse_id = ? AND path LIKE ?`,
+				loc.Path, utf8.RuneCountInString(oldPath)+1, loc.WarehouseID, escapeLike(oldPath)+"/%").Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Save(loc).Error
+	})
+	if err == errLocationExists {
+		return c.Status(409).JSON(fiber.Map{"error": "Location " + loc.Path + " already exists"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not update location"})
+	}
+	return c.JSON(loc)
+}
+
+// escapeLike escapes the LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// DeleteLocation deletes an empty location: one with no locations inside it
+// and no items assigned to it.
+func (h *InventoryHandler) DeleteLocation(c *fiber.Ctx) error {
+	loc, err := h.findLocation(c)
+	if loc == nil {
+		return err
+	}
+
+	var children int64
+	h.PG.Model(&models.StorageLocation{}).Where("parent_id = ?", loc.ID).Count(&children)
+	if children > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "Location still contains other locations"})
+	}
+	if loc.Kind == models.LocationBin {
+		n, err := h.Mongo.Collection("items").CountDocuments(context.TODO(),
+			bson.M{"tenant_id": loc.TenantID.String(), "bin_id": loc.ID.String()}, options.Count().SetLimit(1))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not check bin contents"})
+		}
+		if n > 0 {
+			return c.Status(409).JSON(fiber.Map{"error": "Bin still has items assigned"})
+		}
+	}
+
+	if err := h.PG.Delete(loc).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not delete location"})
+	}
+	return c.JSON(fiber.Map{"message": "Location deleted"})
+}
+
+// GetLocationItems lists the active items in a bin, or in every bin under a
+// zone, aisle or rack.
+func (h *InventoryHandler) GetLocationItems(c *fiber.Ctx) error {
+	loc, err := h.findLocation(c)
+	if loc == nil {
+		return err
+	}
+
+	binIDs := []string{loc.ID.String()}
+	if loc.Kind != models.LocationBin {
+		var bins []models.StorageLocation
+		err := h.PG.Select("id").
+			Where("warehouse_id = ? AND kind = ? AND path LIKE ?", loc.WarehouseID, models.LocationBin, escapeLike(loc.Path)+"/%").
+			Find(&bins).Error
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not fetch bins"})
+		}
+		binIDs = binIDs[:0]
+		for _, b := range bins {
+			binIDs = append(binIDs, b.ID.String())
+		}
+	}
+
+	filter := activeItemFilter(loc.TenantID.String())
+	filter["bin_id"] = bson.M{"$in": binIDs}
+	cursor, err := h.Mongo.Collection("items").Find(context.TODO(), filter,
+		options.Find().SetSort(bson.D{{Key: "name", Value: 1}}).SetLimit(maxItemsLimit))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch items"})
+	}
+	items := []models.Item{}
+	if err = cursor.All(context.TODO(), &items); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse items"})
+	}
+	return c.JSON(items)
+}
+
+// checkBin returns a message for the client unless binID is a bin of the
+// warehouse.
+func (h *InventoryHandler) checkBin(tenantID, warehouseID, binID string) string {
+	if _, err := uuid.Parse(binID); err != nil {
+		return "Invalid bin id"
+	}
+	var loc models.StorageLocation
+	err := h.PG.Where("id = ? AND tenant_id = ?", binID, tenantID).First(&loc).Error
+	if err != nil {
+		return "Bin not found"
+	}
+	if loc.Kind != models.LocationBin {
+		return "Location " + loc.Path + " is a " + loc.Kind + ", not a bin"
+	}
+	if loc.WarehouseID.String() != warehouseID {
+		return "Bin " + loc.Path + " is in another warehouse"
+	}
+	return ""
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/units"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Lots and expiry ---
+//
+// Stock can be received into lots, each with an optional expiry date.
+// Movements that add stock name the lots it goes into in their Lots; stock
+// added without a lot is unlotted. Movements that take stock either name
+// the lot to take from or leave Lots empty, and are then served first
+// expired, first out: lots by expiry date (lots without one last, oldest
+// receipt first), then unlotted stock.
+
+// errInsufficientLot is returned when a named lot holds less than a
+// movement takes from it.
+var errInsufficientLot = errors.New("insufficient stock in lot")
+
+func stockLots(db *mongo.Database) *mongo.Collection {
+	return db.Collection("stock_lots")
+}
+
+func ensureLotIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := stockLots(db).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "item_id", Value: 1}, {Key: "lot_number", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "expiry_date", Value: 1}}},
+	})
+	return err
+}
+
+// applyLots moves m's quantity into or out of item's lots and records the
+// lots touched in m.Lots. It runs in the movement's transaction, which is
+// aborted when a lot cannot give its part.
+func applyLots(ctx context.Context, db *mongo.Database, item models.Item, m *models.StockMovement) error {
+	switch {
+	case m.Quantity > 0:
+		for i, a := range m.Lots {
+			lot, err := receiveIntoLot(ctx, db, item, a, m.CreatedAt)
+			if err != nil {
+				return err
+			}
+			m.Lots[i].LotID, m.Lots[i].ExpiryDate = lot.ID, lot.ExpiryDate
+		}
+		return nil
+	case m.Quantity < 0 && len(m.Lots) > 0:
+		for i, a := range m.Lots {
+			lot, err := takeFromLot(ctx, db, bson.M{"item_id": item.ID, "lot_number": a.LotNumber}, a.Quantity, m.CreatedAt)
+			if err == mongo.ErrNoDocuments {
+				return errInsufficientLot
+			}
+			if err != nil {
+				return err
+			}
+			m.Lots[i].LotID, m.Lots[i].ExpiryDate = lot.ID, lot.ExpiryDate
+		}
+		return nil
+	case m.Quantity < 0:
+		allocations, err := allocateFEFO(ctx, db, item.ID, -m.Quantity, m.CreatedAt)
+		m.Lots = allocations
+		return err
+	}
+	return nil
+}
+
+func receiveIntoLot(ctx context.Context, db *mongo.Database, item models.Item, a models.LotAllocation, at time.Time) (models.StockLot, error) {
+	onInsert := bson.M{
+		"tenant_id":    item.TenantID,
+		"warehouse_id": item.WarehouseID,
+		"received_at":  at,
+	}
+	if a.ExpiryDate != nil {
+		onInsert["expiry_date"] = a.ExpiryDate
+	}
+	var lot models.StockLot
+	err := stockLots(db).FindOneAndUpdate(ctx,
+		bson.M{"item_id": item.ID, "lot_number": a.LotNumber},
+		bson.M{
+			"$inc":         bson.M{"quantity": a.Quantity},
+			"$set":         bson.M{"updated_at": at},
+			"$setOnInsert": onInsert,
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&lot)
+	return lot, err
+}
+
+// takeFromLot takes n from the lot matching filter if it holds that much.
+func takeFromLot(ctx context.Context, db *mongo.Database, filter bson.M, n float64, at time.Time) (models.StockLot, error) {
+	filter["quantity"] = bson.M{"$gte": n}
+	var lot models.StockLot
+	err := stockLots(db).FindOneAndUpdate(ctx, filter,
+		bson.M{"$inc": bson.M{"quantity": -n}, "$set": bson.M{"updated_at": at}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&lot)
+	return lot, err
+}
+
+// allocateFEFO takes up to n from an item's lots, soonest expiry first.
+// Whatever the lots cannot cover comes from unlotted stock.
+func allocateFEFO(ctx context.Context, db *mongo.Database, itemID primitive.ObjectID, n float64, at time.Time) ([]models.LotAllocation, error) {
+	cursor, err := stockLots(db).Find(ctx, bson.M{"item_id": itemID, "quantity": bson.M{"$gt": 0}})
+	if err != nil {
+		return nil, err
+	}
+	var lots []models.StockLot
+	if err := cursor.All(ctx, &lots); err != nil {
+		return nil, err
+	}
+	sortFEFO(lots)
+
+	var allocations []models.LotAllocation
+	for _, lot := range lots {
+		if n == 0 {
+			break
+		}
+		take := min(n, lot.Quantity)
+		if _, err := takeFromLot(ctx, db, bson.M{"_id": lot.ID}, take, at); err == mongo.ErrNoDocuments {
+			// A concurrent issue emptied the lot first.
+			return allocations, errInsufficientLot
+		} else if err != nil {
+			return allocations, err
+		}
+		allocations = append(allocations, models.LotAllocation{
+			LotID:      lot.ID,
+			LotNumber:  lot.LotNumber,
+			ExpiryDate: lot.ExpiryDate,
+			Quantity:   take,
+		})
+		n -= take
+	}
+	return allocations, nil
+}
+
+// sortFEFO orders lots by expiry date, lots without one last, and then by
+// receipt.
+func sortFEFO(lots []models.StockLot) {
+	sort.SliceStable(lots, func(i, j int) bool {
+		a, b := lots[i].ExpiryDate, lots[j].ExpiryDate
+		switch {
+		case a != nil && b != nil && !a.Equal(*b):
+			return a.Before(*b)
+		case (a == nil) != (b == nil):
+			return a != nil
+		}
+		return lots[i].ReceivedAt.Before(lots[j].ReceivedAt)
+	})
+}
+
+// lotRequest is the lot part of a movement request: for stock coming in,
+// the lot it is received into; for stock going out, the lot it must come
+// from instead of FEFO.
+type lotRequest struct {
+	LotNumber  string     `json:"lot_number"`
+	ExpiryDate *time.Time `json:"expiry_date"`
+}
+
+// copyLots returns allocations without their lot ids and with their
+// quantities times ratio, to put the same lots into another item (whose
+// unit may differ).
+func copyLots(allocations []models.LotAllocation, ratio float64) []models.LotAllocation {
+	if len(allocations) == 0 {
+		return nil
+	}
+	out := make([]models.LotAllocation, len(allocations))
+	for i, a := range allocations {
+		a.LotID = primitive.NilObjectID
+		a.Quantity = units.Round(a.Quantity * ratio)
+		out[i] = a
+	}
+	return out
+}
+
+// allocation turns the request into a movement's Lots for quantity n.
+func (r lotRequest) allocation(n float64) []models.LotAllocation {
+	if r.LotNumber == "" {
+		return nil
+	}
+	return []models.LotAllocation{{LotNumber: r.LotNumber, ExpiryDate: r.ExpiryDate, Quantity: n}}
+}
+
+// GetItemLots lists an item's lots in FEFO order; empty=true includes used
+// up lots.
+func (h *InventoryHandler) GetItemLots(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid item id"})
+	}
+
+	filter := bson.M{"tenant_id": tenantID, "item_id": itemID, "quantity": bson.M{"$gt": 0}}
+	if c.QueryBool("empty") {
+		delete(filter, "quantity")
+	}
+	cursor, err := stockLots(h.Mongo).Find(context.TODO(), filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch lots"})
+	}
+	lots := []models.StockLot{}
+	if err = cursor.All(context.TODO(), &lots); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse lots"})
+	}
+	sortFEFO(lots)
+	return c.JSON(lots)
+}
+
+// GetExpiringLots lists lots with stock that expire within ?days (default
+// 30, already expired included), grouped by warehouse and soonest first.
+// warehouse_id narrows it to one warehouse.
+func (h *InventoryHandler) GetExpiringLots(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	days := c.QueryInt("days", 30)
+	if days < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "days cannot be negative"})
+	}
+
+	until := time.Now().AddDate(0, 0, days)
+	filter := bson.M{
+		"tenant_id":   tenantID,
+		"quantity":    bson.M{"$gt": 0},
+		"expiry_date": bson.M{"$lte": until},
+	}
+	if wh := c.Query("warehouse_id"); wh != "" {
+		filter["warehouse_id"] = wh
+	}
+	cursor, err := stockLots(h.Mongo).Find(context.TODO(), filter,
+		options.Find().SetSort(bson.D{{Key: "expiry_date", Value: 1}}).SetLimit(1000))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch lots"})
+	}
+	var lots []models.StockLot
+	if err = cursor.All(context.TODO(), &lots); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse lots"})
+	}
+
+	type warehouseLots struct {
+		WarehouseID string            `json:"warehouse_id"`
+		Lots        []models.StockLot `json:"lots"`
+	}
+	groups := []*warehouseLots{}
+	byWarehouse := map[string]*warehouseLots{}
+	for _, lot := range lots {
+		g := byWarehouse[lot.WarehouseID]
+		if g == nil {
+			g = &warehouseLots{WarehouseID: lot.WarehouseID}
+			byWarehouse[lot.WarehouseID] = g
+			groups = append(groups, g)
+		}
+		g.Lots = append(g.Lots, lot)
+	}
+	return c.JSON(fiber.Map{"days": days, "until": until, "warehouses": groups})
+}
@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/inventory_ai/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Serial numbers ---
+//
+// Stock of a serialized item is made of units with their own serial
+// numbers. Every movement of such an item names one serial per unit it
+// moves: receipts register new units (or take back shipped ones), issues
+// ship them, negative adjustments scrap them and transfers carry them from
+// one item to another. Each unit keeps its history; serial numbers are
+// unique within a tenant, so a unit can be found wherever it is.
+
+var (
+	// errSerialsRequired is returned when a movement of a serialized item
+	// does not name one serial number per unit.
+	errSerialsRequired = errors.New("serial numbers required")
+	// errNotSerialized is returned when a movement names serial numbers for
+	// an item that is not serialized.
+	errNotSerialized = errors.New("item is not serialized")
+)
+
+// serialError reports a unit that cannot make the move asked of it.
+type serialError struct {
+	Serial  string
+	Problem string
+}
+
+func (e *serialError) Error() string {
+	return "serial " + e.Serial + " " + e.Problem
+}
+
+func serialUnits(db *mongo.Database) *mongo.Collection {
+	return db.Collection("serial_units")
+}
+
+func ensureSerialIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := serialUnits(db).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "serial", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "item_id", Value: 1}, {Key: "status", Value: 1}, {Key: "serial", Value: 1}}},
+	})
+	return err
+}
+
+// serialRequest is the serial part of a movement request: the serial
+// numbers of the units moved, one per unit.
+type serialRequest struct {
+	Serials []string `json:"serials"`
+}
+
+// checkSerials trims a request's serial numbers and returns a message for
+// the client when they are not one distinct serial per unit of quantity.
+// No serials at all is fine here; whether the item needs them is only
+// known when the movement is applied.
+func checkSerials(serials []string, quantity float64) string {
+	if len(serials) == 0 {
+		return ""
+	}
+	if float64(len(serials)) != math.Abs(quantity) {
+		return "Give one serial number per unit"
+	}
+	seen := map[string]bool{}
+	for i, s := range serials {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return "Serial numbers cannot be empty"
+		}
+		if seen[s] {
+			return "Serial " + s + " is listed twice"
+		}
+		seen[s] = true
+		serials[i] = s
+	}
+	return ""
+}
+
+// applySerials moves the units m names into or out of item. It runs in the
+// movement's transaction, which is aborted when a unit cannot be moved.
+func applySerials(ctx context.Context, db *mongo.Database, item models.Item, m *models.StockMovement) error {
+	if !item.Serialized {
+		if len(m.Serials) > 0 {
+			return errNotSerialized
+		}
+		return nil
+	}
+	if float64(len(m.Serials)) != math.Abs(m.Quantity) {
+		return errSerialsRequired
+	}
+
+	for _, serial := range m.Serials {
+		var err error
+		switch {
+		case m.Quantity > 0 && m.Type == models.MovementTransfer:
+			err = moveSerial(ctx, db, item, m, serial, []string{models.SerialInTransit}, models.SerialInStock, false)
+		case m.Quantity > 0:
+			err = receiveSerial(ctx, db, item, m, serial)
+		default:
+			err = moveSerial(ctx, db, item, m, serial, models.SerialOnHandStatuses, serialStatusOut(m.Type), true)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serialStatusOut is the state units taken out of stock by a movement of
+// type t end up in.
+func serialStatusOut(t string) string {
+	switch t {
+	case models.MovementIssue:
+		return models.SerialShipped
+	case models.MovementTransfer:
+		return models.SerialInTransit
+	default:
+		return models.SerialScrapped
+	}
+}
+
+func serialEvent(item models.Item, m *models.StockMovement, status string) models.SerialEvent {
+	return models.SerialEvent{
+		At:          m.CreatedAt,
+		Status:      status,
+		ItemID:      item.ID,
+		WarehouseID: item.WarehouseID,
+		MovementID:  m.ID,
+		Reason:      m.Reason,
+		Reference:   m.Reference,
+		UserID:      m.UserID,
+	}
+}
+
+// receiveSerial takes a shipped unit back as returned, or registers a new
+// unit in stock.
+func receiveSerial(ctx context.Context, db *mongo.Database, item models.Item, m *models.StockMovement, serial string) error {
+	err := moveSerial(ctx, db, item, m, serial, []string{models.SerialShipped}, models.SerialReturned, false)
+	if _, ok := err.(*serialError); !ok {
+		return err
+	}
+
+	unit := models.SerialUnit{
+		ID:          primitive.NewObjectID(),
+		TenantID:    item.TenantID,
+		Serial:      serial,
+		ItemID:      item.ID,
+		WarehouseID: item.WarehouseID,
+		SKU:         item.SKU,
+		Status:      models.SerialInStock,
+		History:     []models.SerialEvent{serialEvent(item, m, models.SerialInStock)},
+		CreatedAt:   m.CreatedAt,
+		UpdatedAt:   m.CreatedAt,
+	}
+	_, err = serialUnits(db).InsertOne(ctx, unit)
+	if mongo.IsDuplicateKeyError(err) {
+		return &serialError{Serial: serial, Problem: "is already registered"}
+	}
+	return err
+}
+
+// moveSerial puts the tenant's unit into item with status, provided it is
+// in one of the from states (and, if inItem, already in item).
+func moveSerial(ctx context.Context, db *mongo.Database, item models.Item, m *models.StockMovement, serial string, from []string, status string, inItem bool) error {
+	filter := bson.M{"tenant_id": item.TenantID, "serial": serial, "status": bson.M{"$in": from}}
+	problem := "is not in transit"
+	if inItem {
+		filter["item_id"] = item.ID
+		problem = "is not in stock in this item"
+	} else if status == models.SerialReturned {
+		problem = "has not been shipped"
+	}
+	res, err := serialUnits(db).UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{
+			"item_id":      item.ID,
+			"warehouse_id": item.WarehouseID,
+			"sku":          item.SKU,
+			"status":       status,
+			"updated_at":   m.CreatedAt,
+		},
+		"$push": bson.M{"history": serialEvent(item, m, status)},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return &serialError{Serial: serial, Problem: problem}
+	}
+	return nil
+}
+
+// respondSerialError writes the response for a serial error from a
+// movement and reports whether err was one.
+func respondSerialError(c *fiber.Ctx, err error) (bool, error) {
+	if se, ok := err.(*serialError); ok {
+		return true, c.Status(409).JSON(fiber.Map{"error": "Serial " + se.Serial + " " + se.Problem, "serial": se.Serial})
+	}
+	switch err {
+	case errSerialsRequired:
+		return true, c.Status(400).JSON(fiber.Map{"error": "Item is serialized: give one serial number per unit"})
+	case errNotSerialized:
+		return true, c.Status(400).JSON(fiber.Map{"error": "Item is not serialized"})
+	}
+	return false, nil
+}
+
+// GetSerial looks a serial number up across the tenant's warehouses and
+// returns the unit with its history.
+func (h *InventoryHandler) GetSerial(c *fiber.Ctx) error {
+	unit, err := h.findSerial(c)
+	if unit == nil {
+		return err
+	}
+	return c.JSON(unit)
+}
+
+// findSerial loads the unit in the URL, scoped to the caller's tenant. When
+// it returns nil it has already written the error response.
+func (h *InventoryHandler) findSerial(c *fiber.Ctx) (*models.SerialUnit, error) {
+	tenantID := c.Locals("tenant_id").(string)
+	var unit models.SerialUnit
+	err := serialUnits(h.Mongo).FindOne(context.TODO(), bson.M{"tenant_id": tenantID, "serial": c.Params("serial")}).Decode(&unit)
+	if err == mongo.ErrNoDocuments {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Serial not found"})
+	}
+	if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": "Could not fetch serial"})
+	}
+	return &unit, nil
+}
+
+// GetItemSerials lists an item's units by serial number. status narrows it
+// to one state, or to units counted in stock with "on_hand". Pass
+// next_cursor back as cursor for the following page.
+func (h *InventoryHandler) GetItemSerials(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid item id"})
+	}
+
+	filter := bson.M{"tenant_id": tenantID, "item_id": itemID}
+	switch status := c.Query("status"); status {
+	case "":
+	case "on_hand":
+		filter["status"] = bson.M{"$in": models.SerialOnHandStatuses}
+	default:
+		filter["status"] = status
+	}
+	if after := c.Query("cursor"); after != "" {
+		filter["serial"] = bson.M{"$gt": after}
+	}
+	limit := c.QueryInt("limit", defaultItemsLimit)
+	if limit <= 0 || limit > maxItemsLimit {
+		limit = defaultItemsLimit
+	}
+
+	cursor, err := serialUnits(h.Mongo).Find(context.TODO(), filter,
+		options.Find().SetSort(bson.D{{Key: "serial", Value: 1}}).SetLimit(int64(limit)+1).
+			SetProjection(bson.M{"history": 0}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch serials"})
+	}
+	units := []models.SerialUnit{}
+	if err = cursor.All(context.TODO(), &units); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse serials"})
+	}
+
+	resp := fiber.Map{"has_more": false}
+	if len(units) > limit {
+		units = units[:limit]
+		resp["has_more"] = true
+		resp["next_cursor"] = units[len(units)-1].Serial
+	}
+	resp["serials"] = units
+	return c.JSON(resp)
+}
+
+// serialTransitions lists the states a unit can be set to from each state.
+// Shipping, scrapping and returning a unit changes its item's stock and is
+// recorded as a movement; reserving and releasing it does not.
+var serialTransitions = map[string][]string{
+	models.SerialInStock:  {models.SerialReserved, models.SerialShipped, models.SerialScrapped},
+	models.SerialReserved: {models.SerialInStock, models.SerialShipped, models.SerialScrapped},
+	models.SerialReturned: {models.SerialInStock, models.SerialShipped, models.SerialScrapped},
+	models.SerialShipped:  {models.SerialReturned},
+}
+
+// UpdateSerialStatus moves a unit to another state:
+//
+//	{"status": "shipped", "reason": "...", "reference": "SO-2291"}
+func (h *InventoryHandler) UpdateSerialStatus(c *fiber.Ctx) error {
+	unit, err := h.findSerial(c)
+	if unit == nil {
+		return err
+	}
+
+	var req struct {
+		Status    string `json:"status"`
+		Reason    string `json:"reason"`
+		Reference string `json:"reference"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	allowed := false
+	for _, s := range serialTransitions[unit.Status] {
+		allowed = allowed || s == req.Status
+	}
+	if !allowed {
+		return c.Status(409).JSON(fiber.Map{"error": "A unit that is " + unit.Status + " cannot become " + req.Status, "status": unit.Status})
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	m := &models.StockMovement{
+		Reason:    req.Reason,
+		Reference: req.Reference,
+		Serials:   []string{unit.Serial},
+		UserID:    userID,
+	}
+	switch req.Status {
+	case models.SerialShipped:
+		m.Type, m.Quantity = models.MovementIssue, -1
+	case models.SerialScrapped:
+		m.Type, m.Quantity = models.MovementAdjustment, -1
+		if m.Reason == "" {
+			m.Reason = "scrapped"
+		}
+	case models.SerialReturned:
+		m.Type, m.Quantity = models.MovementReceipt, 1
+		if m.Reason == "" {
+			m.Reason = "returned"
+		}
+	default:
+		return h.setSerialStatus(c, unit, req.Status, m)
+	}
+
+	err = h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		item, err := h.moveStock(ctx, unit.TenantID, unit.ItemID, m, true)
+		if err != nil {
+			return err
+		}
+		return h.emitStockChange(ctx, item, m.Quantity)
+	})
+	if err != nil {
+		return h.respondStockError(c, err, unit.TenantID, unit.ItemID, 1)
+	}
+	unit, err = h.findSerial(c)
+	if unit == nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"serial": unit, "movement": m})
+}
+
+// setSerialStatus changes the state of an on-hand unit without moving
+// stock, provided nobody changed it since it was loaded.
+func (h *InventoryHandler) setSerialStatus(c *fiber.Ctx, unit *models.SerialUnit, status string, m *models.StockMovement) error {
+	now := time.Now()
+	event := models.SerialEvent{
+		At:          now,
+		Status:      status,
+		ItemID:      unit.ItemID,
+		WarehouseID: unit.WarehouseID,
+		Reason:      m.Reason,
+		Reference:   m.Reference,
+		UserID:      m.UserID,
+	}
+	var updated models.SerialUnit
+	err := serialUnits(h.Mongo).FindOneAndUpdate(context.TODO(),
+		bson.M{"_id": unit.ID, "status": unit.Status},
+		bson.M{"$set": bson.M{"status": status, "updated_at": now}, "$push": bson.M{"history": event}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(409).JSON(fiber.Map{"error": "Serial was changed by someone else"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not update serial"})
+	}
+	return c.JSON(fiber.Map{"serial": updated})
+}
@@ -0,0 +1,574 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/units"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Stock movement ledger ---
+//
+// Every change to an item's quantity is recorded as a stock movement, in the
+// same transaction as the change, so the ledger always adds up to the item's
+// quantity and explains how it got there. Movements are never updated or
+// deleted, not even when their item is.
+
+func movements(db *mongo.Database) *mongo.Collection {
+	return db.Collection("stock_movements")
+}
+
+// EnsureStockIndexes creates the indexes behind the movement history and
+// transfers, and of lots and serial units.
+func (h *InventoryHandler) EnsureStockIndexes(ctx context.Context) error {
+	_, err := movements(h.Mongo).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "item_id", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "reference", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		return err
+	}
+	if err := ensureLotIndexes(ctx, h.Mongo); err != nil {
+		return err
+	}
+	if err := ensureSerialIndexes(ctx, h.Mongo); err != nil {
+		return err
+	}
+	_, err = h.transfers().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "status", Value: 1}, {Key: "lines.sku", Value: 1}}},
+	})
+	return err
+}
+
+// appendMovement records a quantity change that has already been applied
+// to its item; m.Balance must hold the item's new quantity.
+func appendMovement(ctx context.Context, db *mongo.Database, m *models.StockMovement) error {
+	if m.ID.IsZero() {
+		m.ID = primitive.NewObjectID()
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	_, err := movements(db).InsertOne(ctx, m)
+	return err
+}
+
+// claimMovement fills in m for item and moves the serial units and lots it
+// names into or out of item.
+func claimMovement(ctx context.Context, db *mongo.Database, item models.Item, m *models.StockMovement) error {
+	if m.ID.IsZero() {
+		m.ID = primitive.NewObjectID()
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	m.TenantID, m.ItemID, m.WarehouseID = item.TenantID, item.ID, item.WarehouseID
+	if err := applySerials(ctx, db, item, m); err != nil {
+		return err
+	}
+	return applyLots(ctx, db, item, m)
+}
+
+// applyMovement adds m.Quantity to the item matching filter and records m.
+// The serial units and lots m names are claimed first, then the quantity
+// changes under filter again. It must run in a transaction: on any error
+// the caller aborts it, so the quantity never moves without its ledger
+// entry, serials and lots.
+// It returns the item as it is afterwards, or mongo.ErrNoDocuments, or
+// errInsufficientLot when a lot m takes from is short, or a serial error
+// when m's serial numbers do not fit the item.
+func applyMovement(ctx context.Context, db *mongo.Database, filter bson.M, m *models.StockMovement) (models.Item, error) {
+	return applyMovementWith(ctx, db, filter, bson.M{}, m)
+}
+
+// errItemChanged is returned when an item changed between being read and
+// being updated from what was read.
+var errItemChanged = errors.New("item changed")
+
+// applyMovementWith is applyMovement making the other changes in update
+// to the item in the same write.
+func applyMovementWith(ctx context.Context, db *mongo.Database, filter, update bson.M, m *models.StockMovement) (models.Item, error) {
+	items := db.Collection("items")
+	var item models.Item
+	if err := items.FindOne(ctx, filter).Decode(&item); err != nil {
+		return item, err
+	}
+	if err := claimMovement(ctx, db, item, m); err != nil {
+		return item, err
+	}
+
+	incFilter := bson.M{"_id": item.ID}
+	for k, v := range filter {
+		incFilter[k] = v
+	}
+	write := bson.M{"$inc": bson.M{"quantity": m.Quantity, "version": 1}, "$set": bson.M{"updated_at": m.CreatedAt}}
+	for op, fields := range update {
+		if op == "$inc" {
+			continue // quantity and version are m's to change
+		}
+		merged, _ := write[op].(bson.M)
+		if merged == nil {
+			merged = bson.M{}
+			write[op] = merged
+		}
+		for k, v := range fields.(bson.M) {
+			merged[k] = v
+		}
+	}
+	err := items.FindOneAndUpdate(ctx, incFilter, write,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&item)
+	if err != nil {
+		return item, err
+	}
+	m.Balance = item.Quantity
+	return item, appendMovement(ctx, db, m)
+}
+
+// errInsufficientStock is returned when a movement would take an item below
+// zero for a tenant that does not allow backorders.
+var errInsufficientStock = errors.New("insufficient stock")
+
+// allowsBackorders reports whether the tenant lets stock go negative.
+func (h *InventoryHandler) allowsBackorders(tenantID string) (bool, error) {
+	var tenant models.Tenant
+	err := h.PG.Select("allow_backorders").Where("id = ?", tenantID).First(&tenant).Error
+	return tenant.AllowBackorders, err
+}
+
+// moveStock applies m to an active item of the tenant in one conditional
+// $inc: unless backorders are allowed, a decrement only matches while at
+// least that much is on hand, so concurrent issues can never oversell.
+// When nothing matches it tells a missing item (mongo.ErrNoDocuments) from
+// one without enough stock (errInsufficientStock).
+func (h *InventoryHandler) moveStock(ctx context.Context, tenantID string, itemID primitive.ObjectID, m *models.StockMovement, allowBackorders bool) (models.Item, error) {
+	filter := activeItemFilter(tenantID)
+	filter["_id"] = itemID
+	guarded := m.Quantity < 0 && !allowBackorders
+	if guarded {
+		filter["quantity"] = bson.M{"$gte": -m.Quantity}
+	}
+
+	item, err := applyMovement(ctx, h.Mongo, filter, m)
+	if err == mongo.ErrNoDocuments && guarded {
+		delete(filter, "quantity")
+		n, err := h.Mongo.Collection("items").CountDocuments(ctx, filter)
+		if err != nil {
+			return item, err
+		}
+		if n > 0 {
+			return item, errInsufficientStock
+		}
+	}
+	return item, err
+}
+
+// respondStockError writes the response for an error from moveStock.
+func (h *InventoryHandler) respondStockError(c *fiber.Ctx, err error, tenantID string, itemID primitive.ObjectID, requested float64) error {
+	if ok, resp := respondSerialError(c, err); ok {
+		return resp
+	}
+	if ue, ok := err.(*units.Error); ok {
+		return c.Status(400).JSON(fiber.Map{"error": ue.Msg})
+	}
+	switch err {
+	case mongo.ErrNoDocuments:
+		return c.Status(404).JSON(fiber.Map{"error": "Item not found"})
+	case errInsufficientLot:
+		return c.Status(409).JSON(fiber.Map{"error": "Insufficient stock in lot", "item_id": itemID, "requested": requested})
+	case errInsufficientStock:
+		resp := fiber.Map{"error": "Insufficient stock", "item_id": itemID, "requested": requested}
+		var item models.Item
+		if h.Mongo.Collection("items").FindOne(context.TODO(), bson.M{"_id": itemID, "tenant_id": tenantID}).Decode(&item) == nil {
+			resp["available"] = item.Quantity
+		}
+		return c.Status(409).JSON(resp)
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": "Could not record movement"})
+	}
+}
+
+// emitStockChange emits the events for an item whose quantity changed by
+// delta.
+func (h *InventoryHandler) emitStockChange(ctx context.Context, item models.Item, delta float64) error {
+	if err := h.Outbox.EmitMongo(ctx, item.TenantID, "item.updated", item); err != nil {
+		return err
+	}
+	before := item
+	before.Quantity -= delta
+	return h.emitLowStock(ctx, before, item)
+}
+
+// PostMovement records a receipt, issue, adjustment or transfer for an item:
+//
+//	{"type": "receipt", "quantity": 10, "reason": "...", "reference": "PO-1042"}
+//
+// Quantity is positive for receipts, issues and transfers, and the signed
+// correction for adjustments, in the item's unit unless unit says
+// otherwise. Transfers need to_item_id, the item that receives the stock.
+// Movements of serialized items list the units' serials. AI scan movements
+// come from detection review only.
+func (h *InventoryHandler) PostMovement(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid item id"})
+	}
+
+	var req struct {
+		Type      string  `json:"type"`
+		Quantity  float64 `json:"quantity"`
+		Reason    string  `json:"reason"`
+		Reference string  `json:"reference"`
+		ToItemID  string  `json:"to_item_id"`
+		unitRequest
+		lotRequest
+		serialRequest
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	sign := 1.0
+	switch req.Type {
+	case models.MovementReceipt, models.MovementIssue, models.MovementTransfer:
+		if req.Quantity <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Quantity must be positive"})
+		}
+		if req.Type != models.MovementReceipt {
+			sign = -1
+		}
+	case models.MovementAdjustment:
+		if req.Quantity == 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Quantity must not be zero"})
+		}
+		if req.Reason == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Adjustments need a reason"})
+		}
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "Type must be receipt, issue, adjustment or transfer"})
+	}
+
+	var toItemID primitive.ObjectID
+	if req.Type == models.MovementTransfer {
+		toItemID, err = primitive.ObjectIDFromHex(req.ToItemID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Transfers need a valid to_item_id"})
+		}
+		if toItemID == itemID {
+			return c.Status(400).JSON(fiber.Map{"error": "Cannot transfer to the same item"})
+		}
+	}
+
+	quantity, entered, err := h.toItemUnit(context.TODO(), tenantID, itemID, req.Quantity, req.Unit)
+	if err != nil {
+		return h.respondStockError(c, err, tenantID, itemID, req.Quantity)
+	}
+	if msg := checkSerials(req.Serials, quantity); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	out := &models.StockMovement{
+		Type:      req.Type,
+		Quantity:  sign * quantity,
+		Reason:    req.Reason,
+		Reference: req.Reference,
+		Lots:      req.allocation(quantity),
+		Serials:   req.Serials,
+		Entered:   entered,
+		UserID:    userID,
+	}
+	var in *models.StockMovement
+	if req.Type == models.MovementTransfer {
+		// The receiving item may keep its stock in another unit.
+		unit := req.Unit
+		if unit == "" {
+			if unit, err = h.unitOf(context.TODO(), tenantID, itemID); err != nil {
+				return h.respondStockError(c, err, tenantID, itemID, req.Quantity)
+			}
+		}
+		inQuantity, inEntered, err := h.toItemUnit(context.TODO(), tenantID, toItemID, req.Quantity, unit)
+		if err != nil {
+			return h.respondStockError(c, err, tenantID, toItemID, req.Quantity)
+		}
+		out.TransferID = uuid.New().String()
+		mirror := *out
+		in = &mirror
+		in.Quantity, in.Entered = inQuantity, inEntered
+	}
+
+	allowBackorders, err := h.allowsBackorders(tenantID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load tenant settings"})
+	}
+
+	var item models.Item
+	err = h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		var err error
+		if item, err = h.moveStock(ctx, tenantID, itemID, out, allowBackorders); err != nil {
+			return err
+		}
+		if err := h.emitStockChange(ctx, item, out.Quantity); err != nil {
+			return err
+		}
+		if in == nil {
+			return nil
+		}
+		in.Lots = copyLots(out.Lots, in.Quantity/quantity)
+		dest, err := h.moveStock(ctx, tenantID, toItemID, in, allowBackorders)
+		if err != nil {
+			return err
+		}
+		return h.emitStockChange(ctx, dest, in.Quantity)
+	})
+	if err != nil {
+		return h.respondStockError(c, err, tenantID, itemID, quantity)
+	}
+
+	resp := fiber.Map{"item": item, "movement": out}
+	if in != nil {
+		resp["counter_movement"] = in
+	}
+	return c.Status(201).JSON(resp)
+}
+
+// stockChangeRequest is the body of IncrementStock and DecrementStock.
+type stockChangeRequest struct {
+	Quantity  float64 `json:"quantity"`
+	Type      string  `json:"type"` // receipt/issue by default, or adjustment
+	Reason    string  `json:"reason"`
+	Reference string  `json:"reference"`
+	unitRequest
+	lotRequest
+	serialRequest
+}
+
+// IncrementStock atomically adds to an item's quantity, recorded as a
+// receipt unless type is "adjustment", and into lot_number if given. The
+// quantity may be in any unit that converts into the item's.
+func (h *InventoryHandler) IncrementStock(c *fiber.Ctx) error {
+	return h.changeStock(c, 1, models.MovementReceipt)
+}
+
+// DecrementStock atomically takes from an item's quantity, recorded as an
+// issue unless type is "adjustment", from lot_number if given and FEFO
+// otherwise. It fails with 409 when less than the
+// quantity is on hand and the tenant does not allow backorders.
+func (h *InventoryHandler) DecrementStock(c *fiber.Ctx) error {
+	return h.changeStock(c, -1, models.MovementIssue)
+}
+
+func (h *InventoryHandler) changeStock(c *fiber.Ctx, sign float64, defaultType string) error {
+	tenantID := c.Locals("tenant_id").(string)
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid item id"})
+	}
+
+	var req stockChangeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if req.Quantity <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Quantity must be positive"})
+	}
+	switch req.Type {
+	case "":
+		req.Type = defaultType
+	case defaultType, models.MovementAdjustment:
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "Type must be " + defaultType + " or adjustment"})
+	}
+	quantity, entered, err := h.toItemUnit(context.TODO(), tenantID, itemID, req.Quantity, req.Unit)
+	if err != nil {
+		return h.respondStockError(c, err, tenantID, itemID, req.Quantity)
+	}
+	if msg := checkSerials(req.Serials, quantity); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	allowBackorders, err := h.allowsBackorders(tenantID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load tenant settings"})
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	m := &models.StockMovement{
+		Type:      req.Type,
+		Quantity:  sign * quantity,
+		Reason:    req.Reason,
+		Reference: req.Reference,
+		Lots:      req.allocation(quantity),
+		Serials:   req.Serials,
+		Entered:   entered,
+		UserID:    userID,
+	}
+	var item models.Item
+	err = h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		var err error
+		if item, err = h.moveStock(ctx, tenantID, itemID, m, allowBackorders); err != nil {
+			return err
+		}
+		return h.emitStockChange(ctx, item, m.Quantity)
+	})
+	if err != nil {
+		return h.respondStockError(c, err, tenantID, itemID, quantity)
+	}
+	return c.JSON(fiber.Map{"item": item, "movement": m})
+}
+
+// GetMovements returns an item's movements, newest first. Pass next_cursor
+// back as cursor for older ones; type narrows to one movement type. The
+// history outlives the item.
+func (h *InventoryHandler) GetMovements(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid item id"})
+	}
+
+	filter := bson.M{"tenant_id": tenantID, "item_id": itemID}
+	if t := c.Query("type"); t != "" {
+		filter["type"] = t
+	}
+	if v := c.Query("cursor"); v != "" {
+		before, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid cursor"})
+		}
+		filter["_id"] = bson.M{"$lt": before}
+	}
+	limit := c.QueryInt("limit", defaultItemsLimit)
+	if limit <= 0 || limit > maxItemsLimit {
+		limit = defaultItemsLimit
+	}
+
+	cursor, err := movements(h.Mongo).Find(context.TODO(), filter,
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit)+1))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch movements"})
+	}
+	list := []models.StockMovement{}
+	if err = cursor.All(context.TODO(), &list); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse movements"})
+	}
+
+	resp := fiber.Map{"has_more": false}
+	if len(list) > limit {
+		list = list[:limit]
+		resp["has_more"] = true
+		resp["next_cursor"] = list[len(list)-1].ID.Hex()
+	}
+	resp["movements"] = list
+	return c.JSON(resp)
+}
+
+// GetLedger checks an item's quantity against the sum of its movements.
+func (h *InventoryHandler) GetLedger(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid item id"})
+	}
+
+	var item models.Item
+	err = h.Mongo.Collection("items").FindOne(context.TODO(), bson.M{"_id": itemID, "tenant_id": tenantID}).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(404).JSON(fiber.Map{"error": "Item not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch item"})
+	}
+
+	balance, count, err := ledgerBalance(context.TODO(), h.Mongo, tenantID, itemID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not sum movements"})
+	}
+	return c.JSON(fiber.Map{
+		"item_id":        item.ID,
+		"quantity":       item.Quantity,
+		"ledger_balance": balance,
+		"movements":      count,
+		"in_sync":        units.Round(balance) == units.Round(item.Quantity),
+	})
+}
+
+// ledgerBalance sums an item's movements.
+func ledgerBalance(ctx context.Context, db *mongo.Database, tenantID string, itemID primitive.ObjectID) (float64, int, error) {
+	cursor, err := movements(db).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"tenant_id": tenantID, "item_id": itemID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     nil,
+			"balance": bson.M{"$sum": "$quantity"},
+			"count":   bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	var sums []struct {
+		Balance float64 `bson:"balance"`
+		Count   int     `bson:"count"`
+	}
+	if err := cursor.All(ctx, &sums); err != nil || len(sums) == 0 {
+		return 0, 0, err
+	}
+	return sums[0].Balance, sums[0].Count, nil
+}
+
+// BackfillLedger opens the ledger of items that have stock but no
+// movements (those created before the ledger existed) with an adjustment
+// for their current quantity.
+func (h *InventoryHandler) BackfillLedger(ctx context.Context) error {
+	filter := activeItemFilter("")
+	delete(filter, "tenant_id")
+	filter["quantity"] = bson.M{"$ne": 0}
+	cursor, err := h.Mongo.Collection("items").Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	n := 0
+	for cursor.Next(ctx) {
+		var item models.Item
+		if err := cursor.Decode(&item); err != nil {
+			return err
+		}
+		exists, err := movements(h.Mongo).CountDocuments(ctx,
+			bson.M{"tenant_id": item.TenantID, "item_id": item.ID}, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			continue
+		}
+		err = appendMovement(ctx, h.Mongo, &models.StockMovement{
+			TenantID:    item.TenantID,
+			ItemID:      item.ID,
+			WarehouseID: item.WarehouseID,
+			Type:        models.MovementAdjustment,
+			Quantity:    item.Quantity,
+			Balance:     item.Quantity,
+			Reason:      "opening balance",
+		})
+		if err != nil {
+			return err
+		}
+		n++
+	}
+	if n > 0 {
+		log.Printf("Stock ledger: opened %d items", n)
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/outbox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const testTenant = "00000000-0000-0000-0000-000000000001"
+
+// testMongo returns a fresh database on the MongoDB replica set in
+// INVENTORY_TEST_MONGO_URI, dropped after the test. Tests that need
+// MongoDB are skipped without it.
+func testMongo(t *testing.T) *mongo.Database {
+	t.Helper()
+	uri := os.Getenv("INVENTORY_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("INVENTORY_TEST_MONGO_URI not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	db := client.Database("inventory_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		db.Drop(ctx)
+		client.Disconnect(ctx)
+	})
+	if err := ensureLotIndexes(ctx, db); err != nil {
+		t.Fatalf("lot indexes: %v", err)
+	}
+	if err := ensureSerialIndexes(ctx, db); err != nil {
+		t.Fatalf("serial indexes: %v", err)
+	}
+	return db
+}
+
+// insertItem stores an empty active item of the test tenant.
+func insertItem(t *testing.T, db *mongo.Database, item models.Item) models.Item {
+	t.Helper()
+	item.ID = primitive.NewObjectID()
+	item.TenantID = testTenant
+	item.Status = models.ItemStatusActive
+	item.CreatedAt = time.Now()
+	if _, err := db.Collection("items").InsertOne(context.Background(), item); err != nil {
+		t.Fatalf("insert item: %v", err)
+	}
+	return item
+}
+
+// move applies m to item through applyMovement, in a transaction as the
+// handlers do.
+func move(t *testing.T, db *mongo.Database, item models.Item, m models.StockMovement) error {
+	t.Helper()
+	return (&outbox.Outbox{Mongo: db}).RunMongo(context.Background(), func(ctx context.Context) error {
+		_, err := applyMovement(ctx, db, bson.M{"_id": item.ID, "tenant_id": testTenant}, &m)
+		return err
+	})
+}
+
+// assertStock checks that item's quantity and its ledger both stand at want.
+func assertStock(t *testing.T, db *mongo.Database, item models.Item, want float64) {
+	t.Helper()
+	ctx := context.Background()
+	var current models.Item
+	if err := db.Collection("items").FindOne(ctx, bson.M{"_id": item.ID}).Decode(&current); err != nil {
+		t.Fatalf("fetch item: %v", err)
+	}
+	balance, _, err := ledgerBalance(ctx, db, testTenant, item.ID)
+	if err != nil {
+		t.Fatalf("ledger: %v", err)
+	}
+	if current.Quantity != want || balance != want {
+		t.Fatalf("quantity %v, ledger %v; want both %v", current.Quantity, balance, want)
+	}
+}
+
+func TestApplyMovementShortLotLeavesStock(t *testing.T) {
+	db := testMongo(t)
+	item := insertItem(t, db, models.Item{Name: "Milk"})
+
+	receipts := []models.StockMovement{
+		{Type: models.MovementReceipt, Quantity: 2, Lots: []models.LotAllocation{{LotNumber: "L1", Quantity: 2}}},
+		{Type: models.MovementReceipt, Quantity: 3},
+	}
+	for _, m := range receipts {
+		if err := move(t, db, item, m); err != nil {
+			t.Fatalf("receipt: %v", err)
+		}
+	}
+
+	err := move(t, db, item, models.StockMovement{
+		Type: models.MovementIssue, Quantity: -3, Lots: []models.LotAllocation{{LotNumber: "L1", Quantity: 3}},
+	})
+	if err != errInsufficientLot {
+		t.Fatalf("issue from short lot: got %v, want errInsufficientLot", err)
+	}
+	assertStock(t, db, item, 5)
+
+	var lot models.StockLot
+	if err := stockLots(db).FindOne(context.Background(), bson.M{"item_id": item.ID, "lot_number": "L1"}).Decode(&lot); err != nil {
+		t.Fatalf("fetch lot: %v", err)
+	}
+	if lot.Quantity != 2 {
+		t.Fatalf("lot L1 holds %v, want 2", lot.Quantity)
+	}
+}
+
+func TestApplyMovementBadSerialLeavesStock(t *testing.T) {
+	db := testMongo(t)
+	item := insertItem(t, db, models.Item{Name: "Drill", Serialized: true})
+	if err := move(t, db, item, models.StockMovement{Type: models.MovementReceipt, Quantity: 2, Serials: []string{"A", "B"}}); err != nil {
+		t.Fatalf("receipt: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		m    models.StockMovement
+	}{
+		{"issue of unknown serial", models.StockMovement{Type: models.MovementIssue, Quantity: -2, Serials: []string{"A", "Z"}}},
+		{"receipt of registered serial", models.StockMovement{Type: models.MovementReceipt, Quantity: 2, Serials: []string{"C", "A"}}},
+		{"missing serials", models.StockMovement{Type: models.MovementIssue, Quantity: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := move(t, db, item, tt.m); err == nil {
+				t.Fatal("movement applied, want an error")
+			}
+			assertStock(t, db, item, 2)
+
+			ctx := context.Background()
+			n, err := serialUnits(db).CountDocuments(ctx, bson.M{"item_id": item.ID, "status": models.SerialInStock})
+			if err != nil || n != 2 {
+				t.Fatalf("%d units in stock (%v), want 2", n, err)
+			}
+			if n, _ := serialUnits(db).CountDocuments(ctx, bson.M{"serial": "C"}); n != 0 {
+				t.Fatal("unit C stayed registered")
+			}
+			var a models.SerialUnit
+			if err := serialUnits(db).FindOne(ctx, bson.M{"serial": "A"}).Decode(&a); err != nil || len(a.History) != 1 {
+				t.Fatalf("unit A history %v (%v), want the receipt only", a.History, err)
+			}
+		})
+	}
+}
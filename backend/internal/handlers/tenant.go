@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/inventory_ai/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+type TenantHandler struct {
+	PG *gorm.DB
+}
+
+func NewTenantHandler(pg *gorm.DB) *TenantHandler {
+	return &TenantHandler{PG: pg}
+}
+
+// findTenant loads the caller's tenant. When it returns nil it has already
+// written the error response.
+func (h *TenantHandler) findTenant(c *fiber.Ctx) (*models.Tenant, error) {
+	tenantID := c.Locals("tenant_id").(string)
+	var tenant models.Tenant
+	if err := h.PG.Where("id = ?", tenantID).First(&tenant).Error; err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": "Could not fetch tenant"})
+	}
+	return &tenant, nil
+}
+
+func (h *TenantHandler) GetTenant(c *fiber.Ctx) error {
+	tenant, err := h.findTenant(c)
+	if tenant == nil {
+		return err
+	}
+	return c.JSON(tenant)
+}
+
+// UpdateTenant changes the tenant's name and stock settings.
+func (h *TenantHandler) UpdateTenant(c *fiber.Ctx) error {
+	tenant, err := h.findTenant(c)
+	if tenant == nil {
+		return err
+	}
+
+	var req struct {
+		Name            string `json:"name"`
+		AllowBackorders *bool  `json:"allow_backorders"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != "" {
+		updates["name"] = req.Name
+	}
+	if req.AllowBackorders != nil {
+		updates["allow_backorders"] = *req.AllowBackorders
+	}
+	if len(updates) > 0 {
+		if err := h.PG.Model(tenant).Updates(updates).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not update tenant"})
+		}
+	}
+	return c.JSON(tenant)
+}
@@ -0,0 +1,660 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/units"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Inter-warehouse transfers ---
+//
+// Stock of a SKU lives in one item per warehouse. A transfer takes stock
+// out of the source warehouse's item when dispatched and puts it into the
+// destination warehouse's item when received, creating that item from the
+// source one if the destination has never stocked the SKU.
+
+func (h *InventoryHandler) transfers() *mongo.Collection {
+	return h.Mongo.Collection("stock_transfers")
+}
+
+// transferLineError reports which line of a transfer could not be moved.
+type transferLineError struct {
+	SKU string
+	Err error
+}
+
+func (e *transferLineError) Error() string {
+	return "sku " + e.SKU + ": " + e.Err.Error()
+}
+
+// errTransferState is returned when a transfer left the state an action
+// needs while the action was running.
+var errTransferState = errors.New("transfer state changed")
+
+type transferRequest struct {
+	SourceWarehouseID      string                `json:"source_warehouse_id"`
+	DestinationWarehouseID string                `json:"destination_warehouse_id"`
+	Lines                  []models.TransferLine `json:"lines"`
+	Note                   string                `json:"note"`
+}
+
+// validateTransfer checks the request and returns a message for the client
+// when it is invalid.
+func (h *InventoryHandler) validateTransfer(tenantID string, req *transferRequest) string {
+	if req.SourceWarehouseID == req.DestinationWarehouseID {
+		return "Source and destination warehouses must differ"
+	}
+	ids := []string{req.SourceWarehouseID, req.DestinationWarehouseID}
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			return "Invalid warehouse id " + id
+		}
+	}
+	var n int64
+	if err := h.PG.Model(&models.Warehouse{}).Where("tenant_id = ? AND id IN ?", tenantID, ids).Count(&n).Error; err != nil || n != 2 {
+		return "Warehouse not found"
+	}
+
+	if len(req.Lines) == 0 {
+		return "At least one line is required"
+	}
+	cat, err := h.units(tenantID)
+	if err != nil {
+		return "Could not load units"
+	}
+	seen := map[string]bool{}
+	for i := range req.Lines {
+		line := &req.Lines[i]
+		line.SKU = strings.TrimSpace(line.SKU)
+		line.SourceItemID, line.DestinationItemID, line.Lots = "", "", nil
+		if line.SKU == "" {
+			return "Every line needs a SKU"
+		}
+		if line.Quantity <= 0 {
+			return "Quantity of " + line.SKU + " must be positive"
+		}
+		if msg := checkSerials(line.Serials, line.Quantity); msg != "" {
+			return line.SKU + ": " + msg
+		}
+		if _, _, ok := cat.Base(line.Unit); line.Unit != "" && !ok {
+			return "Unknown unit " + line.Unit
+		}
+		if seen[line.SKU] {
+			return "SKU " + line.SKU + " is listed twice"
+		}
+		seen[line.SKU] = true
+	}
+	return ""
+}
+
+func (h *InventoryHandler) CreateTransfer(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	userID, _ := c.Locals("user_id").(string)
+
+	var req transferRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if msg := h.validateTransfer(tenantID, &req); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	now := time.Now()
+	t := models.StockTransfer{
+		ID:                     uuid.New().String(),
+		TenantID:               tenantID,
+		SourceWarehouseID:      req.SourceWarehouseID,
+		DestinationWarehouseID: req.DestinationWarehouseID,
+		Status:                 models.TransferDraft,
+		Lines:                  req.Lines,
+		Note:                   req.Note,
+		CreatedBy:              userID,
+		CreatedAt:              now,
+		UpdatedAt:              now,
+	}
+	err := h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		if _, err := h.transfers().InsertOne(ctx, t); err != nil {
+			return err
+		}
+		return h.Outbox.EmitMongo(ctx, tenantID, "transfer.created", t)
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create transfer"})
+	}
+	return c.Status(201).JSON(t)
+}
+
+// GetTransfers lists transfers, newest first, optionally by status or by a
+// warehouse at either end.
+func (h *InventoryHandler) GetTransfers(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	filter := bson.M{"tenant_id": tenantID}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	if wh := c.Query("warehouse_id"); wh != "" {
+		filter["$or"] = bson.A{
+			bson.M{"source_warehouse_id": wh},
+			bson.M{"destination_warehouse_id": wh},
+		}
+	}
+	limit := c.QueryInt("limit", defaultItemsLimit)
+	if limit <= 0 || limit > maxItemsLimit {
+		limit = defaultItemsLimit
+	}
+
+	cursor, err := h.transfers().Find(context.TODO(), filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch transfers"})
+	}
+	list := []models.StockTransfer{}
+	if err = cursor.All(context.TODO(), &list); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse transfers"})
+	}
+	return c.JSON(list)
+}
+
+// findTransfer loads the transfer in the URL, scoped to the caller's tenant.
+// When it returns nil it has already written the error response.
+func (h *InventoryHandler) findTransfer(c *fiber.Ctx) (*models.StockTransfer, error) {
+	tenantID := c.Locals("tenant_id").(string)
+	var t models.StockTransfer
+	err := h.transfers().FindOne(context.TODO(), bson.M{"_id": c.Params("id"), "tenant_id": tenantID}).Decode(&t)
+	if err == mongo.ErrNoDocuments {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Transfer not found"})
+	}
+	if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": "Could not fetch transfer"})
+	}
+	return &t, nil
+}
+
+func (h *InventoryHandler) GetTransfer(c *fiber.Ctx) error {
+	t, err := h.findTransfer(c)
+	if t == nil {
+		return err
+	}
+	return c.JSON(t)
+}
+
+// UpdateTransfer replaces the warehouses, lines and note of a draft.
+func (h *InventoryHandler) UpdateTransfer(c *fiber.Ctx) error {
+	t, err := h.findTransfer(c)
+	if t == nil {
+		return err
+	}
+	if t.Status != models.TransferDraft {
+		return c.Status(409).JSON(fiber.Map{"error": "Only draft transfers can be edited"})
+	}
+
+	req := transferRequest{
+		SourceWarehouseID:      t.SourceWarehouseID,
+		DestinationWarehouseID: t.DestinationWarehouseID,
+		Lines:                  t.Lines,
+		Note:                   t.Note,
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if msg := h.validateTransfer(t.TenantID, &req); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	var updated models.StockTransfer
+	err = h.transfers().FindOneAndUpdate(context.TODO(),
+		bson.M{"_id": t.ID, "status": models.TransferDraft},
+		bson.M{"$set": bson.M{
+			"source_warehouse_id":      req.SourceWarehouseID,
+			"destination_warehouse_id": req.DestinationWarehouseID,
+			"lines":                    req.Lines,
+			"note":                     req.Note,
+			"updated_at":               time.Now(),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(409).JSON(fiber.Map{"error": "Only draft transfers can be edited"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not update transfer"})
+	}
+	return c.JSON(updated)
+}
+
+// claimTransfer moves a transfer from one state to another, failing with
+// errTransferState if someone else changed it first.
+func (h *InventoryHandler) claimTransfer(ctx context.Context, t *models.StockTransfer, from, to string, set bson.M) error {
+	set["status"] = to
+	set["updated_at"] = time.Now()
+	res, err := h.transfers().UpdateOne(ctx, bson.M{"_id": t.ID, "status": from}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errTransferState
+	}
+	t.Status = to
+	return nil
+}
+
+// findStockItem returns the tenant's active item for sku in a warehouse,
+// the oldest if there are several.
+func (h *InventoryHandler) findStockItem(ctx context.Context, tenantID, warehouseID, sku string) (models.Item, error) {
+	filter := activeItemFilter(tenantID)
+	filter["warehouse_id"] = warehouseID
+	filter["sku"] = sku
+	var item models.Item
+	err := h.Mongo.Collection("items").FindOne(ctx, filter,
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}})).Decode(&item)
+	return item, err
+}
+
+// moveTransferLine applies one line's movement to an item and emits its
+// change; errors name the line's SKU.
+func (h *InventoryHandler) moveTransferLine(ctx context.Context, t *models.StockTransfer, line models.TransferLine, itemID primitive.ObjectID, m *models.StockMovement, allowBackorders bool) error {
+	m.Reference, m.TransferID = t.ID, t.ID
+	item, err := h.moveStock(ctx, t.TenantID, itemID, m, allowBackorders)
+	if err != nil {
+		return &transferLineError{SKU: line.SKU, Err: err}
+	}
+	return h.emitStockChange(ctx, item, m.Quantity)
+}
+
+// lineQuantity converts a line's quantity into item's unit; a line without
+// a unit is in it already. Converted quantities come with the quantity as
+// given, for the movement.
+func lineQuantity(cat units.Catalogue, line models.TransferLine, item models.Item) (float64, *models.Measure, error) {
+	if line.Unit == "" || line.Unit == itemUnit(item) {
+		return line.Quantity, nil, nil
+	}
+	q, err := cat.Convert(line.Quantity, line.Unit, itemUnit(item))
+	return q, &models.Measure{Quantity: line.Quantity, Unit: line.Unit}, err
+}
+
+// DispatchTransfer takes every line's stock out of the source warehouse and
+// puts the transfer in transit, with each line's quantity converted to the
+// source item's unit. It fails as a whole, with 409, when a SKU is
+// missing from the source or short of stock.
+func (h *InventoryHandler) DispatchTransfer(c *fiber.Ctx) error {
+	t, err := h.findTransfer(c)
+	if t == nil {
+		return err
+	}
+	if t.Status != models.TransferDraft {
+		return c.Status(409).JSON(fiber.Map{"error": "Only draft transfers can be dispatched"})
+	}
+	allowBackorders, err := h.allowsBackorders(t.TenantID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load tenant settings"})
+	}
+	cat, err := h.units(t.TenantID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load units"})
+	}
+	userID, _ := c.Locals("user_id").(string)
+
+	if err := h.dispatchTransfer(context.TODO(), t, cat, allowBackorders, userID); err != nil {
+		return h.respondTransferError(c, err, "dispatched")
+	}
+	return c.JSON(t)
+}
+
+// dispatchTransfer claims a draft transfer and moves all its lines out of
+// the source warehouse in one transaction, so a line that cannot be moved
+// leaves the transfer a draft and the lines before it untouched.
+func (h *InventoryHandler) dispatchTransfer(ctx context.Context, t *models.StockTransfer, cat units.Catalogue, allowBackorders bool, userID string) error {
+	now := time.Now()
+	return h.Outbox.RunMongo(ctx, func(ctx context.Context) error {
+		if err := h.claimTransfer(ctx, t, models.TransferDraft, models.TransferInTransit, bson.M{"dispatched_at": now}); err != nil {
+			return err
+		}
+		for i, line := range t.Lines {
+			item, err := h.findStockItem(ctx, t.TenantID, t.SourceWarehouseID, line.SKU)
+			if err == mongo.ErrNoDocuments {
+				return &transferLineError{SKU: line.SKU, Err: errNotFound}
+			}
+			if err != nil {
+				return err
+			}
+			quantity, entered, err := lineQuantity(cat, line, item)
+			if err != nil {
+				return &transferLineError{SKU: line.SKU, Err: err}
+			}
+			m := &models.StockMovement{
+				Type:     models.MovementTransfer,
+				Quantity: -quantity,
+				Reason:   "dispatched to warehouse " + t.DestinationWarehouseID,
+				Serials:  line.Serials,
+				Entered:  entered,
+				UserID:   userID,
+			}
+			if err := h.moveTransferLine(ctx, t, line, item.ID, m, allowBackorders); err != nil {
+				return err
+			}
+			t.Lines[i].SourceItemID = item.ID.Hex()
+			t.Lines[i].Quantity, t.Lines[i].Unit = quantity, itemUnit(item)
+			t.Lines[i].Lots = m.Lots
+		}
+		if _, err := h.transfers().UpdateOne(ctx, bson.M{"_id": t.ID}, bson.M{"$set": bson.M{"lines": t.Lines}}); err != nil {
+			return err
+		}
+		t.DispatchedAt, t.UpdatedAt = &now, now
+		return h.Outbox.EmitMongo(ctx, t.TenantID, "transfer.dispatched", t)
+	})
+}
+
+// ReceiveTransfer puts every line's stock into the destination warehouse.
+func (h *InventoryHandler) ReceiveTransfer(c *fiber.Ctx) error {
+	t, err := h.findTransfer(c)
+	if t == nil {
+		return err
+	}
+	if t.Status != models.TransferInTransit {
+		return c.Status(409).JSON(fiber.Map{"error": "Only transfers in transit can be received"})
+	}
+	cat, err := h.units(t.TenantID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load units"})
+	}
+	userID, _ := c.Locals("user_id").(string)
+
+	now := time.Now()
+	err = h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		if err := h.claimTransfer(ctx, t, models.TransferInTransit, models.TransferReceived, bson.M{"received_at": now}); err != nil {
+			return err
+		}
+		for i, line := range t.Lines {
+			item, err := h.destinationItem(ctx, t, line)
+			if err != nil {
+				return &transferLineError{SKU: line.SKU, Err: err}
+			}
+			quantity, entered, err := lineQuantity(cat, line, item)
+			if err != nil {
+				return &transferLineError{SKU: line.SKU, Err: err}
+			}
+			err = h.moveTransferLine(ctx, t, line, item.ID, &models.StockMovement{
+				Type:     models.MovementTransfer,
+				Quantity: quantity,
+				Reason:   "received from warehouse " + t.SourceWarehouseID,
+				Lots:     copyLots(line.Lots, quantity/line.Quantity),
+				Serials:  line.Serials,
+				Entered:  entered,
+				UserID:   userID,
+			}, true)
+			if err != nil {
+				return err
+			}
+			t.Lines[i].DestinationItemID = item.ID.Hex()
+		}
+		if _, err := h.transfers().UpdateOne(ctx, bson.M{"_id": t.ID}, bson.M{"$set": bson.M{"lines": t.Lines}}); err != nil {
+			return err
+		}
+		t.ReceivedAt, t.UpdatedAt = &now, now
+		return h.Outbox.EmitMongo(ctx, t.TenantID, "transfer.received", t)
+	})
+	if err != nil {
+		return h.respondTransferError(c, err, "received")
+	}
+	return c.JSON(t)
+}
+
+// destinationItem returns the destination warehouse's item for a line's
+// SKU, creating it with no stock from the source item (or from the SKU
+// alone, if that is gone) when the warehouse has never stocked the SKU.
+func (h *InventoryHandler) destinationItem(ctx context.Context, t *models.StockTransfer, line models.TransferLine) (models.Item, error) {
+	item, err := h.findStockItem(ctx, t.TenantID, t.DestinationWarehouseID, line.SKU)
+	if err != mongo.ErrNoDocuments {
+		return item, err
+	}
+
+	item = models.Item{Name: line.SKU, SKU: line.SKU, Attributes: map[string]interface{}{}}
+	if id, err := primitive.ObjectIDFromHex(line.SourceItemID); err == nil {
+		var source models.Item
+		err := h.Mongo.Collection("items").FindOne(ctx, bson.M{"_id": id, "tenant_id": t.TenantID}).Decode(&source)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return item, err
+		}
+		if err == nil {
+			item = source
+		}
+	}
+
+	now := time.Now()
+	item.ID = primitive.NewObjectID()
+	item.TenantID = t.TenantID
+	item.WarehouseID, item.BinID = t.DestinationWarehouseID, ""
+	item.Quantity = 0
+	item.Status = models.ItemStatusActive
+	item.JobID, item.BatchID, item.MergedInto, item.AILog = "", "", nil, nil
+	item.Version = 1
+	item.CreatedAt, item.UpdatedAt = now, now
+	indexItem(&item)
+	if _, err := h.Mongo.Collection("items").InsertOne(ctx, item); err != nil {
+		return item, err
+	}
+	return item, h.Outbox.EmitMongo(ctx, t.TenantID, "item.created", item)
+}
+
+// CancelTransfer cancels a draft, or a transfer in transit, whose stock then
+// goes back to the source warehouse.
+func (h *InventoryHandler) CancelTransfer(c *fiber.Ctx) error {
+	t, err := h.findTransfer(c)
+	if t == nil {
+		return err
+	}
+	from := t.Status
+	if from != models.TransferDraft && from != models.TransferInTransit {
+		return c.Status(409).JSON(fiber.Map{"error": "Only draft transfers and transfers in transit can be cancelled"})
+	}
+	userID, _ := c.Locals("user_id").(string)
+
+	now := time.Now()
+	err = h.Outbox.RunMongo(context.TODO(), func(ctx context.Context) error {
+		if err := h.claimTransfer(ctx, t, from, models.TransferCancelled, bson.M{"cancelled_at": now}); err != nil {
+			return err
+		}
+		if from == models.TransferInTransit {
+			for _, line := range t.Lines {
+				itemID, err := primitive.ObjectIDFromHex(line.SourceItemID)
+				if err != nil {
+					return &transferLineError{SKU: line.SKU, Err: errNotFound}
+				}
+				err = h.moveTransferLine(ctx, t, line, itemID, &models.StockMovement{
+					Type:     models.MovementTransfer,
+					Quantity: line.Quantity,
+					Reason:   "transfer cancelled",
+					Lots:     copyLots(line.Lots, 1),
+					Serials:  line.Serials,
+					UserID:   userID,
+				}, true)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		t.CancelledAt, t.UpdatedAt = &now, now
+		return h.Outbox.EmitMongo(ctx, t.TenantID, "transfer.cancelled", t)
+	})
+	if err != nil {
+		return h.respondTransferError(c, err, "cancelled")
+	}
+	return c.JSON(t)
+}
+
+func (h *InventoryHandler) respondTransferError(c *fiber.Ctx, err error, action string) error {
+	if err == errTransferState {
+		return c.Status(409).JSON(fiber.Map{"error": "Transfer was changed by someone else"})
+	}
+	lineErr, ok := err.(*transferLineError)
+	if !ok {
+		return c.Status(500).JSON(fiber.Map{"error": "Transfer could not be " + action})
+	}
+	if ue, ok := lineErr.Err.(*units.Error); ok {
+		return c.Status(409).JSON(fiber.Map{"error": "SKU " + lineErr.SKU + ": " + ue.Msg, "sku": lineErr.SKU})
+	}
+	if se, ok := lineErr.Err.(*serialError); ok {
+		return c.Status(409).JSON(fiber.Map{"error": "Serial " + se.Serial + " of SKU " + lineErr.SKU + " " + se.Problem, "sku": lineErr.SKU, "serial": se.Serial})
+	}
+	switch lineErr.Err {
+	case errNotFound, mongo.ErrNoDocuments:
+		return c.Status(409).JSON(fiber.Map{"error": "No item with SKU " + lineErr.SKU + " to move", "sku": lineErr.SKU})
+	case errInsufficientStock, errInsufficientLot:
+		return c.Status(409).JSON(fiber.Map{"error": "Insufficient stock of SKU " + lineErr.SKU, "sku": lineErr.SKU})
+	case errSerialsRequired:
+		return c.Status(409).JSON(fiber.Map{"error": "SKU " + lineErr.SKU + " is serialized: give one serial number per unit", "sku": lineErr.SKU})
+	case errNotSerialized:
+		return c.Status(409).JSON(fiber.Map{"error": "SKU " + lineErr.SKU + " is not serialized", "sku": lineErr.SKU})
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": "Transfer could not be " + action})
+	}
+}
+
+// --- Stock levels ---
+
+// GetStockLevels returns, per SKU, the quantity on hand in each warehouse,
+// the total and the quantity in transit between warehouses. Warehouses
+// may keep a SKU in different units, so totals are converted into base
+// units and given by base unit: {"pcs": 30} for 1 dozen and 18 pcs. sku
+// (comma separated) and warehouse_id narrow it down; pass next_cursor back
+// as cursor for the following SKUs.
+func (h *InventoryHandler) GetStockLevels(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	match := activeItemFilter(tenantID)
+	match["sku"] = bson.M{"$nin": bson.A{"", nil}}
+	if v := c.Query("sku"); v != "" {
+		match["sku"] = bson.M{"$in": strings.Split(v, ",")}
+	}
+	if v := c.Query("warehouse_id"); v != "" {
+		match["warehouse_id"] = v
+	}
+	limit := c.QueryInt("limit", defaultItemsLimit)
+	if limit <= 0 || limit > maxItemsLimit {
+		limit = defaultItemsLimit
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":  "$sku",
+			"name": bson.M{"$first": "$name"},
+			"warehouses": bson.M{"$push": bson.M{
+				"warehouse_id": "$warehouse_id",
+				"item_id":      "$_id",
+				"quantity":     "$quantity",
+				"unit":         "$unit",
+			}},
+		}}},
+	}
+	if v := c.Query("cursor"); v != "" {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"_id": bson.M{"$gt": v}}}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		bson.D{{Key: "$limit", Value: limit + 1}},
+	)
+
+	cursor, err := h.Mongo.Collection("items").Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch stock levels"})
+	}
+	type warehouseLevel struct {
+		WarehouseID string             `bson:"warehouse_id" json:"warehouse_id"`
+		ItemID      primitive.ObjectID `bson:"item_id" json:"item_id"`
+		Quantity    float64            `bson:"quantity" json:"quantity"`
+		Unit        string             `bson:"unit,omitempty" json:"unit,omitempty"`
+	}
+	levels := []struct {
+		SKU        string             `bson:"_id" json:"sku"`
+		Name       string             `bson:"name" json:"name"`
+		Totals     map[string]float64 `bson:"-" json:"totals"`     // by base unit
+		InTransit  map[string]float64 `bson:"-" json:"in_transit"` // by base unit
+		Warehouses []warehouseLevel   `bson:"warehouses" json:"warehouses"`
+	}{}
+	if err = cursor.All(context.TODO(), &levels); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not parse stock levels"})
+	}
+	cat, err := h.units(tenantID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not load units"})
+	}
+	for i := range levels {
+		totals := map[string]float64{}
+		for _, w := range levels[i].Warehouses {
+			q, base := cat.ToBase(w.Quantity, w.Unit)
+			totals[base] = units.Round(totals[base] + q)
+		}
+		levels[i].Totals, levels[i].InTransit = totals, map[string]float64{}
+	}
+
+	resp := fiber.Map{"has_more": false}
+	if len(levels) > limit {
+		levels = levels[:limit]
+		resp["has_more"] = true
+		resp["next_cursor"] = levels[len(levels)-1].SKU
+	}
+
+	if len(levels) > 0 {
+		skus := make([]string, len(levels))
+		for i, l := range levels {
+			skus[i] = l.SKU
+		}
+		inTransit, err := h.inTransit(tenantID, skus, cat)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not fetch transfers in transit"})
+		}
+		for i := range levels {
+			if q, ok := inTransit[levels[i].SKU]; ok {
+				levels[i].InTransit = q
+			}
+		}
+	}
+	resp["levels"] = levels
+	return c.JSON(resp)
+}
+
+// inTransit sums the quantities of skus on transfers in transit, by SKU
+// and base unit.
+func (h *InventoryHandler) inTransit(tenantID string, skus []string, cat units.Catalogue) (map[string]map[string]float64, error) {
+	cursor, err := h.transfers().Aggregate(context.TODO(), mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"tenant_id": tenantID, "status": models.TransferInTransit}}},
+		{{Key: "$unwind", Value: "$lines"}},
+		{{Key: "$match", Value: bson.M{"lines.sku": bson.M{"$in": skus}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"sku": "$lines.sku", "unit": "$lines.unit"},
+			"quantity": bson.M{"$sum": "$lines.quantity"},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var sums []struct {
+		Line struct {
+			SKU  string `bson:"sku"`
+			Unit string `bson:"unit"`
+		} `bson:"_id"`
+		Quantity float64 `bson:"quantity"`
+	}
+	if err := cursor.All(context.TODO(), &sums); err != nil {
+		return nil, err
+	}
+	out := make(map[string]map[string]float64, len(sums))
+	for _, s := range sums {
+		if out[s.Line.SKU] == nil {
+			out[s.Line.SKU] = map[string]float64{}
+		}
+		q, base := cat.ToBase(s.Quantity, s.Line.Unit)
+		out[s.Line.SKU][base] = units.Round(out[s.Line.SKU][base] + q)
+	}
+	return out, nil
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/outbox"
+	"github.com/inventory_ai/backend/internal/units"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDispatchTransferShortLastLineMovesNothing(t *testing.T) {
+	db := testMongo(t)
+	h := &InventoryHandler{Mongo: db, Outbox: &outbox.Outbox{Mongo: db}}
+	ctx := context.Background()
+
+	stock := map[string]float64{"A": 5, "B": 4, "C": 1}
+	items := map[string]models.Item{}
+	for sku, q := range stock {
+		item := insertItem(t, db, models.Item{Name: sku, SKU: sku, WarehouseID: "src"})
+		if err := move(t, db, item, models.StockMovement{Type: models.MovementReceipt, Quantity: q}); err != nil {
+			t.Fatalf("receipt of %s: %v", sku, err)
+		}
+		items[sku] = item
+	}
+
+	transfer := models.StockTransfer{
+		ID:                     "tr-1",
+		TenantID:               testTenant,
+		SourceWarehouseID:      "src",
+		DestinationWarehouseID: "dst",
+		Status:                 models.TransferDraft,
+		Lines:                  []models.TransferLine{{SKU: "A", Quantity: 3}, {SKU: "B", Quantity: 4}, {SKU: "C", Quantity: 2}},
+		CreatedAt:              time.Now(),
+	}
+	if _, err := h.transfers().InsertOne(ctx, transfer); err != nil {
+		t.Fatalf("insert transfer: %v", err)
+	}
+
+	err := h.dispatchTransfer(ctx, &transfer, units.Catalogue{}, false, "")
+	var lineErr *transferLineError
+	if !errors.As(err, &lineErr) || lineErr.SKU != "C" || lineErr.Err != errInsufficientStock {
+		t.Fatalf("dispatch: got %v, want insufficient stock of C", err)
+	}
+
+	var stored models.StockTransfer
+	if err := h.transfers().FindOne(ctx, bson.M{"_id": "tr-1"}).Decode(&stored); err != nil {
+		t.Fatalf("fetch transfer: %v", err)
+	}
+	if stored.Status != models.TransferDraft || stored.DispatchedAt != nil {
+		t.Fatalf("transfer is %s (dispatched at %v), want an undispatched draft", stored.Status, stored.DispatchedAt)
+	}
+	for sku, q := range stock {
+		assertStock(t, db, items[sku], q)
+	}
+	if n, _ := db.Collection("outbox").CountDocuments(ctx, bson.M{"type": "transfer.dispatched"}); n != 0 {
+		t.Fatal("transfer.dispatched was emitted")
+	}
+}
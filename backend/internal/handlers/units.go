@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/units"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+)
+
+// --- Units of measure ---
+//
+// Each item keeps its quantity in its own base unit. Stock operations can
+// give a quantity in any unit of the tenant's catalogue that converts into
+// the item's; it is converted before it is applied, and the movement keeps
+// the quantity as it was entered.
+
+// itemUnit returns the base unit of item.
+func itemUnit(item models.Item) string {
+	if item.Unit == "" {
+		return models.DefaultUnit
+	}
+	return item.Unit
+}
+
+// unitRequest is the unit part of a stock request: the unit its quantity
+// is given in, the item's base unit when empty.
+type unitRequest struct {
+	Unit string `json:"unit"`
+}
+
+// units loads the standard units and the tenant's own.
+func (h *InventoryHandler) units(tenantID string) (units.Catalogue, error) {
+	return units.Load(h.PG, tenantID)
+}
+
+// checkUnit returns a message for the client unless code is in the
+// tenant's catalogue.
+func (h *InventoryHandler) checkUnit(tenantID, code string) string {
+	cat, err := h.units(tenantID)
+	if err != nil {
+		return "Could not load units"
+	}
+	if _, _, ok := cat.Base(code); !ok {
+		return "Unknown unit " + code
+	}
+	return ""
+}
+
+// unitOf returns the base unit of the tenant's item.
+func (h *InventoryHandler) unitOf(ctx context.Context, tenantID string, itemID primitive.ObjectID) (string, error) {
+	var item models.Item
+	err := h.Mongo.Collection("items").FindOne(ctx, bson.M{"_id": itemID, "tenant_id": tenantID},
+		options.FindOne().SetProjection(bson.M{"unit": 1})).Decode(&item)
+	return itemUnit(item), err
+}
+
+// toItemUnit converts q, given in unit, into the base unit of the tenant's
+// item. Unless unit is empty or already the item's, it also returns the
+// quantity as entered, for the movement.
+func (h *InventoryHandler) toItemUnit(ctx context.Context, tenantID string, itemID primitive.ObjectID, q float64, unit string) (float64, *models.Measure, error) {
+	if unit == "" {
+		return q, nil, nil
+	}
+	base, err := h.unitOf(ctx, tenantID, itemID)
+	if err != nil || base == unit {
+		return q, nil, err
+	}
+	cat, err := h.units(tenantID)
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := cat.Convert(q, unit, base)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n == 0 && q != 0 {
+		return 0, nil, &units.Error{Msg: "Quantity is too small to keep in " + base}
+	}
+	return n, &models.Measure{Quantity: q, Unit: unit}, nil
+}
+
+// GetUnits lists the standard units followed by the tenant's own.
+func (h *InventoryHandler) GetUnits(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	var custom []models.Unit
+	if err := h.PG.Where("tenant_id = ?", tenantID).Order("code").Find(&custom).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch units"})
+	}
+	return c.JSON(append(append([]models.Unit{}, models.StandardUnits...), custom...))
+}
+
+// CreateUnit adds a unit to the tenant's catalogue, defined as factor of an
+// existing unit or, without base_code, as a base unit of its own:
+//
+//	{"code": "box", "name": "box of 24", "base_code": "pcs", "factor": 24}
+func (h *InventoryHandler) CreateUnit(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	var unit models.Unit
+	if err := c.BodyParser(&unit); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	unit.Code = strings.TrimSpace(unit.Code)
+	if unit.Code == "" || strings.ContainsAny(unit.Code, " \t") {
+		return c.Status(400).JSON(fiber.Map{"error": "Code is required and cannot contain spaces"})
+	}
+
+	cat, err := h.units(tenantID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch units"})
+	}
+	if _, taken := cat[unit.Code]; taken {
+		return c.Status(409).JSON(fiber.Map{"error": "Unit " + unit.Code + " already exists"})
+	}
+	if unit.BaseCode == "" {
+		unit.Factor = 1
+	} else {
+		if _, ok := cat[unit.BaseCode]; !ok {
+			return c.Status(400).JSON(fiber.Map{"error": "Unknown unit " + unit.BaseCode})
+		}
+		if unit.Factor <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Factor must be positive"})
+		}
+	}
+
+	unit.ID = uuid.Nil
+	unit.TenantID = uuid.MustParse(tenantID)
+	unit.Standard = false
+	if err := h.PG.Create(&unit).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create unit"})
+	}
+	return c.Status(201).JSON(unit)
+}
+
+// findUnit loads the tenant's unit in the URL. When it returns nil it has
+// already written the error response.
+func (h *InventoryHandler) findUnit(c *fiber.Ctx) (*models.Unit, error) {
+	tenantID := c.Locals("tenant_id").(string)
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "Invalid unit id"})
+	}
+	var unit models.Unit
+	err = h.PG.Where("id = ? AND tenant_id = ?", id, tenantID).First(&unit).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Unit not found"})
+	}
+	if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": "Could not fetch unit"})
+	}
+	return &unit, nil
+}
+
+// UpdateUnit renames a unit or changes its factor. Items keep their
+// quantity in their own unit, which may be this one or defined in it; a
+// new factor would revalue their stock, so it is refused (409) while any
+// such item exists.
+func (h *InventoryHandler) UpdateUnit(c *fiber.Ctx) error {
+	unit, err := h.findUnit(c)
+	if unit == nil {
+		return err
+	}
+
+	var req struct {
+		Name   *string  `json:"name"`
+		Factor *float64 `json:"factor"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if req.Name != nil {
+		unit.Name = *req.Name
+	}
+	if req.Factor != nil {
+		if unit.BaseCode == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Base units have no factor"})
+		}
+		if *req.Factor <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Factor must be positive"})
+		}
+		if *req.Factor != unit.Factor {
+			cat, err := h.units(unit.TenantID.String())
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Could not fetch units"})
+			}
+			n, err := h.Mongo.Collection("items").CountDocuments(context.TODO(),
+				bson.M{"tenant_id": unit.TenantID.String(), "unit": bson.M{"$in": definedIn(cat, unit.Code)}},
+				options.Count().SetLimit(1))
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Could not check items"})
+			}
+			if n > 0 {
+				return c.Status(409).JSON(fiber.Map{"error": "Items keep stock in " + unit.Code + "; its factor cannot change"})
+			}
+		}
+		unit.Factor = *req.Factor
+	}
+	if err := h.PG.Save(unit).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not update unit"})
+	}
+	return c.JSON(unit)
+}
+
+// definedIn returns code and every unit of cat whose definition leads
+// through it.
+func definedIn(cat units.Catalogue, code string) []string {
+	codes := []string{code}
+	for c := range cat {
+		if c == code {
+			continue
+		}
+		next := cat[c].BaseCode
+		for range len(cat) {
+			if next == "" {
+				break
+			}
+			if next == code {
+				codes = append(codes, c)
+				break
+			}
+			next = cat[next].BaseCode
+		}
+	}
+	return codes
+}
+
+// DeleteUnit deletes a unit no item has as its base unit and no other unit
+// is defined in.
+func (h *InventoryHandler) DeleteUnit(c *fiber.Ctx) error {
+	unit, err := h.findUnit(c)
+	if unit == nil {
+		return err
+	}
+
+	var dependents int64
+	h.PG.Model(&models.Unit{}).Where("tenant_id = ? AND base_code = ?", unit.TenantID, unit.Code).Count(&dependents)
+	if dependents > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "Other units are defined in " + unit.Code})
+	}
+	n, err := h.Mongo.Collection("items").CountDocuments(context.TODO(),
+		bson.M{"tenant_id": unit.TenantID.String(), "unit": unit.Code}, options.Count().SetLimit(1))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not check items"})
+	}
+	if n > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "Items still use " + unit.Code})
+	}
+
+	if err := h.PG.Delete(unit).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not delete unit"})
+	}
+	return c.JSON(fiber.Map{"message": "Unit deleted"})
+}
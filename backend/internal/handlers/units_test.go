@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/inventory_ai/backend/internal/units"
+)
+
+func TestDefinedIn(t *testing.T) {
+	cat := units.Catalogue{
+		"pcs":    {Code: "pcs", Factor: 1},
+		"box":    {Code: "box", BaseCode: "pcs", Factor: 24},
+		"case":   {Code: "case", BaseCode: "box", Factor: 4},
+		"pallet": {Code: "pallet", BaseCode: "case", Factor: 40},
+		"dozen":  {Code: "dozen", BaseCode: "pcs", Factor: 12},
+		"kg":     {Code: "kg", Factor: 1},
+		"a":      {Code: "a", BaseCode: "b", Factor: 2},
+		"b":      {Code: "b", BaseCode: "a", Factor: 2},
+	}
+	tests := []struct {
+		code string
+		want []string
+	}{
+		{"box", []string{"box", "case", "pallet"}},
+		{"case", []string{"case", "pallet"}},
+		{"pallet", []string{"pallet"}},
+		{"kg", []string{"kg"}},
+		{"a", []string{"a", "b"}}, // a loop ends
+	}
+	for _, tt := range tests {
+		got := definedIn(cat, tt.code)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("definedIn(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
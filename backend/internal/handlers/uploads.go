@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/inventory_ai/backend/internal/storage"
+)
+
+// --- Uploaded blobs ---
+//
+// Uploads are not public. The AI worker and anyone else handed a blob URL
+// (storage.BlobStore.URL) fetch it with the signature in its query, until
+// it expires. Signed in users fetch their tenant's blobs by key through
+// the API; items keep that path (uploadPath) rather than a URL that
+// expires.
+
+type UploadHandler struct {
+	Store  storage.BlobStore
+	Signer *storage.Signer
+}
+
+func NewUploadHandler(store storage.BlobStore, signer *storage.Signer) *UploadHandler {
+	return &UploadHandler{Store: store, Signer: signer}
+}
+
+// uploadPath is the API path a tenant's blob is served under.
+func uploadPath(key string) string {
+	return "/api/v1/uploads/" + strings.TrimLeft(key, "/")
+}
+
+// GetSigned serves /uploads/<key>?expires=...&sig=..., the URLs handed out
+// by the blob store.
+func (h *UploadHandler) GetSigned(c *fiber.Ctx) error {
+	key := c.Params("*")
+	if err := h.Signer.Verify(key, c.Query("expires"), c.Query("sig")); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	return h.send(c, key)
+}
+
+// GetUpload serves one of the signed in tenant's blobs by key.
+func (h *UploadHandler) GetUpload(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	key := c.Params("*")
+	if !strings.HasPrefix(path.Clean("/"+key), "/tenants/"+tenantID+"/") {
+		return c.Status(404).JSON(fiber.Map{"error": "Upload not found"})
+	}
+	return h.send(c, key)
+}
+
+func (h *UploadHandler) send(c *fiber.Ctx, key string) error {
+	blob, err := h.Store.Open(context.TODO(), key)
+	if err == storage.ErrNotFound {
+		return c.Status(404).JSON(fiber.Map{"error": "Upload not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not read upload"})
+	}
+	if ct := mime.TypeByExtension(path.Ext(key)); ct != "" {
+		c.Set(fiber.HeaderContentType, ct)
+	}
+	c.Set(fiber.HeaderCacheControl, "private, max-age=300")
+	return c.SendStream(blob)
+}
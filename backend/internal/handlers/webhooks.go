@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/webhooks"
+	"gorm.io/gorm"
+)
+
+type WebhookHandler struct {
+	PG *gorm.DB
+}
+
+func NewWebhookHandler(pg *gorm.DB) *WebhookHandler {
+	return &WebhookHandler{PG: pg}
+}
+
+// validateSubscription checks a subscription's URL and event types and
+// returns a message for the client when they are invalid. The URL must
+// point to a public host; see webhooks.CheckURL.
+func validateSubscription(rawURL string, eventTypes []string) string {
+	if err := webhooks.CheckURL(context.TODO(), rawURL); err == webhooks.ErrBlockedTarget {
+		return "URL must point to a public host"
+	} else if err != nil {
+		return err.Error()
+	}
+	if len(eventTypes) == 0 {
+		return "At least one event type is required"
+	}
+	for _, t := range eventTypes {
+		if !webhooks.ValidEventType(t) {
+			return "Unknown event type " + t
+		}
+	}
+	return ""
+}
+
+func (h *WebhookHandler) CreateSubscription(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+
+	var req struct {
+		URL         string   `json:"url"`
+		Secret      string   `json:"secret"`
+		EventTypes  []string `json:"event_types"`
+		Description string   `json:"description"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if msg := validateSubscription(req.URL, req.EventTypes); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if req.Secret == "" {
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not generate secret"})
+		}
+		req.Secret = secret
+	}
+
+	sub := models.WebhookSubscription{
+		TenantID:    uuid.MustParse(tenantID),
+		URL:         req.URL,
+		Secret:      req.Secret,
+		EventTypes:  req.EventTypes,
+		Description: req.Description,
+		Active:      true,
+	}
+	if err := h.PG.Create(&sub).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create webhook"})
+	}
+	// The secret is only ever shown here.
+	return c.Status(201).JSON(fiber.Map{"subscription": sub, "secret": sub.Secret})
+}
+
+func (h *WebhookHandler) GetSubscriptions(c *fiber.Ctx) error {
+	tenantID := c.Locals("tenant_id").(string)
+	subs := []models.WebhookSubscription{}
+	if err := h.PG.Where("tenant_id = ?", tenantID).Order("created_at").Find(&subs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch webhooks"})
+	}
+	return c.JSON(subs)
+}
+
+// findSubscription loads the subscription in the URL, scoped to the caller's
+// tenant. When it returns nil it has already written the error response.
+func (h *WebhookHandler) findSubscription(c *fiber.Ctx) (*models.WebhookSubscription, error) {
+	tenantID := c.Locals("tenant_id").(string)
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "Invalid webhook id"})
+	}
+
+	var sub models.WebhookSubscription
+	err = h.PG.Where("id = ? AND tenant_id = ?", id, tenantID).First(&sub).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Webhook not found"})
+	}
+	if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": "Could not fetch webhook"})
+	}
+	return &sub, nil
+}
+
+func (h *WebhookHandler) GetSubscription(c *fiber.Ctx) error {
+	sub, err := h.findSubscription(c)
+	if sub == nil {
+		return err
+	}
+	return c.JSON(sub)
+}
+
+func (h *WebhookHandler) UpdateSubscription(c *fiber.Ctx) error {
+	sub, err := h.findSubscription(c)
+	if sub == nil {
+		return err
+	}
+
+	var req struct {
+		URL         string   `json:"url"`
+		EventTypes  []string `json:"event_types"`
+		Description *string  `json:"description"`
+		Active      *bool    `json:"active"`
+		// RotateSecret replaces the signing secret; the new one is returned.
+		RotateSecret bool `json:"rotate_secret"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	if req.URL != "" {
+		sub.URL = req.URL
+	}
+	if req.EventTypes != nil {
+		sub.EventTypes = req.EventTypes
+	}
+	if msg := validateSubscription(sub.URL, sub.EventTypes); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if req.Description != nil {
+		sub.Description = *req.Description
+	}
+	if req.Active != nil {
+		sub.Active = *req.Active
+	}
+	if req.RotateSecret {
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not generate secret"})
+		}
+		sub.Secret = secret
+	}
+
+	if err := h.PG.Save(sub).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not update webhook"})
+	}
+	if req.RotateSecret {
+		return c.JSON(fiber.Map{"subscription": sub, "secret": sub.Secret})
+	}
+	return c.JSON(sub)
+}
+
+// DeleteSubscription removes a webhook and its delivery log.
+func (h *WebhookHandler) DeleteSubscription(c *fiber.Ctx) error {
+	sub, err := h.findSubscription(c)
+	if sub == nil {
+		return err
+	}
+	err = h.PG.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", sub.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(sub).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not delete webhook"})
+	}
+	return c.JSON(fiber.Map{"message": "Webhook deleted"})
+}
+
+// --- Delivery logs ---
+
+func (h *WebhookHandler) GetDeliveries(c *fiber.Ctx) error {
+	sub, err := h.findSubscription(c)
+	if sub == nil {
+		return err
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	query := h.PG.Where("subscription_id = ?", sub.ID).Order("created_at DESC").Limit(limit)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if eventType := c.Query("event_type"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	if err := query.Find(&deliveries).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch deliveries"})
+	}
+	return c.JSON(deliveries)
+}
+
+func (h *WebhookHandler) findDelivery(c *fiber.Ctx, sub *models.WebhookSubscription) (*models.WebhookDelivery, error) {
+	id, err := uuid.Parse(c.Params("deliveryId"))
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "Invalid delivery id"})
+	}
+	var del models.WebhookDelivery
+	err = h.PG.Where("id = ? AND subscription_id = ?", id, sub.ID).First(&del).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Delivery not found"})
+	}
+	if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": "Could not fetch delivery"})
+	}
+	return &del, nil
+}
+
+func (h *WebhookHandler) GetDelivery(c *fiber.Ctx) error {
+	sub, err := h.findSubscription(c)
+	if sub == nil {
+		return err
+	}
+	del, err := h.findDelivery(c, sub)
+	if del == nil {
+		return err
+	}
+	return c.JSON(del)
+}
+
+// Redeliver sends a delivery again with its original payload and a fresh
+// attempt budget; its attempt log is kept.
+func (h *WebhookHandler) Redeliver(c *fiber.Ctx) error {
+	sub, err := h.findSubscription(c)
+	if sub == nil {
+		return err
+	}
+	if !sub.Active {
+		return c.Status(409).JSON(fiber.Map{"error": "Webhook is inactive"})
+	}
+	del, err := h.findDelivery(c, sub)
+	if del == nil {
+		return err
+	}
+
+	res := h.PG.Model(del).
+		Where("status <> ? OR next_attempt_at > ?", models.WebhookDeliveryPending, time.Now()).
+		Updates(map[string]interface{}{
+			"status":          models.WebhookDeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	if res.Error != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not redeliver"})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Delivery scheduled", "delivery_id": del.ID})
+}
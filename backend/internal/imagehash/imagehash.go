@@ -0,0 +1,94 @@
+// Package imagehash computes perceptual hashes, which stay close for
+// re-encoded, resized or slightly re-framed copies of the same photo.
+package imagehash
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // register decoders
+	_ "image/png"
+	"math/bits"
+	"strconv"
+)
+
+// ErrUnsupported is returned for images there is no decoder for.
+var ErrUnsupported = errors.New("imagehash: unsupported image format")
+
+// Hash is a 64-bit difference hash (dHash).
+type Hash uint64
+
+// String formats h as 16 hex digits, the form it is stored in.
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Parse reads a hash formatted by String.
+func Parse(s string) (Hash, error) {
+	v, err := strconv.ParseUint(s, 16, 64)
+	return Hash(v), err
+}
+
+// Distance is the number of differing bits; 0 means identical, and up to
+// about 10 of 64 is usually the same picture.
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a) ^ uint64(b))
+}
+
+// Compute decodes data and returns its dHash: the image is shrunk to 9x8
+// grey levels and each bit records whether a pixel is brighter than its
+// right neighbour.
+func Compute(data []byte) (Hash, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return 0, ErrUnsupported
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	const w, hgt = 9, 8
+	grid := shrink(img, w, hgt)
+	var h Hash
+	for y := 0; y < hgt; y++ {
+		for x := 0; x < w-1; x++ {
+			h <<= 1
+			if grid[y*w+x] > grid[y*w+x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h, nil
+}
+
+// shrink averages img down to w x h luminance values, row by row.
+func shrink(img image.Image, w, h int) []float64 {
+	b := img.Bounds()
+	out := make([]float64, w*h)
+	for gy := 0; gy < h; gy++ {
+		y0 := b.Min.Y + gy*b.Dy()/h
+		y1 := max(b.Min.Y+(gy+1)*b.Dy()/h, y0+1)
+		for gx := 0; gx < w; gx++ {
+			x0 := b.Min.X + gx*b.Dx()/w
+			x1 := max(b.Min.X+(gx+1)*b.Dx()/w, x0+1)
+
+			// Sample at most 16x16 pixels per cell; plenty for an average
+			// and keeps large photos cheap.
+			sx, sy := max((x1-x0)/16, 1), max((y1-y0)/16, 1)
+			var sum float64
+			var n int
+			for y := y0; y < y1 && y < b.Max.Y; y += sy {
+				for x := x0; x < x1 && x < b.Max.X; x += sx {
+					sum += float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+					n++
+				}
+			}
+			if n > 0 {
+				out[gy*w+gx] = sum / float64(n)
+			}
+		}
+	}
+	return out
+}
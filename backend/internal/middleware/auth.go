@@ -49,3 +49,17 @@ func Protected() fiber.Handler {
 		return c.Next()
 	}
 }
+
+// RequireRole only lets through users whose JWT role is one of roles.
+// It must run after Protected.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		for _, r := range roles {
+			if role == r {
+				return c.Next()
+			}
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Insufficient permissions"})
+	}
+}
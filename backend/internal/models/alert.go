@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Stock alert states. An alert is open while its item is low on stock until
+// someone acknowledges it or snoozes it; a snoozed alert opens again at
+// SnoozedUntil if the item is still low. It is resolved once the item is
+// back above its reorder point, or deleted.
+const (
+	AlertOpen         = "open"
+	AlertAcknowledged = "acknowledged"
+	AlertSnoozed      = "snoozed"
+	AlertResolved     = "resolved"
+)
+
+// Alert levels: low at or below the reorder point, critical below the
+// minimum quantity or out of stock.
+const (
+	AlertLow      = "low"
+	AlertCritical = "critical"
+)
+
+// StockAlert is raised when an item's stock falls to its reorder point. An
+// item has at most one active (unresolved) alert, kept up to date as its
+// quantity changes.
+type StockAlert struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID          string             `bson:"tenant_id" json:"tenant_id"`
+	ItemID            primitive.ObjectID `bson:"item_id" json:"item_id"`
+	WarehouseID       string             `bson:"warehouse_id,omitempty" json:"warehouse_id,omitempty"`
+	SKU               string             `bson:"sku,omitempty" json:"sku,omitempty"`
+	Name              string             `bson:"name" json:"name"`
+	Level             string             `bson:"level" json:"level"`
+	Status            string             `bson:"status" json:"status"`
+	Active            bool               `bson:"active" json:"-"`
+	Quantity          float64            `bson:"quantity" json:"quantity"`
+	Unit              string             `bson:"unit,omitempty" json:"unit,omitempty"`
+	ReorderPoint      float64            `bson:"reorder_point" json:"reorder_point"`
+	MinQuantity       float64            `bson:"min_quantity,omitempty" json:"min_quantity,omitempty"`
+	MaxQuantity       float64            `bson:"max_quantity,omitempty" json:"max_quantity,omitempty"`
+	Incoming          float64            `bson:"incoming,omitempty" json:"incoming,omitempty"` // in transit to the warehouse
+	SuggestedQuantity float64            `bson:"suggested_quantity" json:"suggested_quantity"` // to reorder
+	SnoozedUntil      *time.Time         `bson:"snoozed_until,omitempty" json:"snoozed_until,omitempty"`
+	AcknowledgedBy    string             `bson:"acknowledged_by,omitempty" json:"acknowledged_by,omitempty"`
+	AcknowledgedAt    *time.Time         `bson:"acknowledged_at,omitempty" json:"acknowledged_at,omitempty"`
+	RaisedAt          time.Time          `bson:"raised_at" json:"raised_at"`
+	UpdatedAt         time.Time          `bson:"updated_at" json:"updated_at"`
+	ResolvedAt        *time.Time         `bson:"resolved_at,omitempty" json:"resolved_at,omitempty"`
+}
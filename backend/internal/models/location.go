@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Storage location kinds, outermost first. Each kind sits under the one
+// before it: zones directly under the warehouse, bins inside racks.
+const (
+	LocationZone  = "zone"
+	LocationAisle = "aisle"
+	LocationRack  = "rack"
+	LocationBin   = "bin"
+)
+
+// LocationKinds lists the kinds in hierarchy order.
+var LocationKinds = []string{LocationZone, LocationAisle, LocationRack, LocationBin}
+
+// StorageLocation is a zone, aisle, rack or bin of a warehouse. Path is the
+// codes from the zone down joined by "/", e.g. "Z1/A03/R2/B05", and is
+// unique within the warehouse.
+type StorageLocation struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	TenantID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"tenant_id"`
+	WarehouseID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_location_path" json:"warehouse_id"`
+	ParentID    *uuid.UUID `gorm:"type:uuid;index" json:"parent_id"`
+	Kind        string     `gorm:"not null" json:"kind"`
+	Code        string     `gorm:"not null" json:"code"`
+	Name        string     `json:"name"`
+	Path        string     `gorm:"not null;uniqueIndex:idx_location_path" json:"path"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (StorageLocation) TableName() string {
+	return "storage_locations"
+}
+
+func (l *StorageLocation) BeforeCreate(tx *gorm.DB) (err error) {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return
+}
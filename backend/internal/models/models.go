@@ -13,6 +13,10 @@ type Tenant struct {
 	Plan      string    `gorm:"default:'demo'" json:"plan"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// AllowBackorders lets stock go below zero instead of rejecting issues
+	// that exceed what is on hand.
+	AllowBackorders bool `gorm:"not null;default:false" json:"allow_backorders"`
 }
 
 func (Tenant) TableName() string {
@@ -33,6 +37,7 @@ type Warehouse struct {
 	TenantID  uuid.UUID `gorm:"type:uuid;not null" json:"tenant_id"`
 	Name      string    `gorm:"not null" json:"name"`
 	Location  string    `json:"location"`
+	Version   int       `gorm:"not null;default:1" json:"version"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -41,6 +46,7 @@ type Category struct {
 	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
 	TenantID  uuid.UUID `gorm:"type:uuid;not null" json:"tenant_id"`
 	Name      string    `gorm:"not null" json:"name"`
+	Version   int       `gorm:"not null;default:1" json:"version"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
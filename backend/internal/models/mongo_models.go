@@ -3,21 +3,178 @@ package models
 import (
 	"time"
 
+	mongo_models "github.com/inventory_ai/backend/database/mongo"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Item statuses. Items created by hand have no status (active); items
+// created from AI detections start as drafts and are either approved
+// (becoming active), merged into an existing item, or rejected.
+const (
+	ItemStatusActive   = ""
+	ItemStatusDraft    = "draft"
+	ItemStatusMerged   = "merged"
+	ItemStatusRejected = "rejected"
+)
+
 type Item struct {
-	ID          primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
-	TenantID    string                 `bson:"tenant_id" json:"tenant_id"`
-	WarehouseID string                 `bson:"warehouse_id" json:"warehouse_id"`
-	CategoryID  string                 `bson:"category_id" json:"category_id"`
-	Name        string                 `bson:"name" json:"name"`
-	Description string                 `bson:"description" json:"description"`
-	SKU         string                 `bson:"sku" json:"sku"`
-	Quantity    int                    `bson:"quantity" json:"quantity"`
-	Price       float64                `bson:"price" json:"price"`
-	Images      []string               `bson:"images" json:"images"`
-	Attributes  map[string]interface{} `bson:"attributes" json:"attributes"` // Flexible schema
-	CreatedAt   time.Time              `bson:"created_at" json:"created_at"`
-	UpdatedAt   time.Time              `bson:"updated_at" json:"updated_at"`
+	ID           primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	TenantID     string                 `bson:"tenant_id" json:"tenant_id"`
+	WarehouseID  string                 `bson:"warehouse_id" json:"warehouse_id"`
+	BinID        string                 `bson:"bin_id,omitempty" json:"bin_id,omitempty"` // StorageLocation of kind bin in the warehouse
+	CategoryID   string                 `bson:"category_id" json:"category_id"`
+	Name         string                 `bson:"name" json:"name"`
+	Description  string                 `bson:"description" json:"description"`
+	SKU          string                 `bson:"sku" json:"sku"`
+	Quantity     float64                `bson:"quantity" json:"quantity"`
+	Unit         string                 `bson:"unit,omitempty" json:"unit,omitempty"` // base unit of Quantity; "" is DefaultUnit
+	Price        float64                `bson:"price" json:"price"`
+	Images       []string               `bson:"images" json:"images"`
+	Tags         []string               `bson:"tags,omitempty" json:"tags,omitempty"`
+	Attributes   map[string]interface{} `bson:"attributes" json:"attributes"`                           // Flexible schema
+	ReorderPoint float64                `bson:"reorder_point,omitempty" json:"reorder_point,omitempty"` // low stock at or below; 0 = off
+	MinQuantity  float64                `bson:"min_quantity,omitempty" json:"min_quantity,omitempty"`   // safety stock; critical below
+	MaxQuantity  float64                `bson:"max_quantity,omitempty" json:"max_quantity,omitempty"`   // level to reorder up to
+	Serialized   bool                   `bson:"serialized,omitempty" json:"serialized,omitempty"`       // stock is tracked as SerialUnits
+	Status       string                 `bson:"status,omitempty" json:"status,omitempty"`
+	Version      int                    `bson:"version" json:"version"`
+	JobID        string                 `bson:"job_id,omitempty" json:"job_id,omitempty"` // AI job that detected this item
+	BatchID      string                 `bson:"batch_id,omitempty" json:"batch_id,omitempty"`
+	MergedInto   *primitive.ObjectID    `bson:"merged_into,omitempty" json:"merged_into,omitempty"`
+	AILog        *mongo_models.AILog    `bson:"ai_log,omitempty" json:"ai_log,omitempty"`
+	CreatedAt    time.Time              `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time              `bson:"updated_at" json:"updated_at"`
+	SearchGrams  []string               `bson:"search_grams,omitempty" json:"-"` // see handlers.indexItem
+}
+
+// AI job lifecycle states. A job is pending until the outbox relay has
+// handed it to RabbitMQ and the broker confirmed it.
+const (
+	AIJobPending    = "pending"
+	AIJobQueued     = "queued"
+	AIJobProcessing = "processing"
+	AIJobSucceeded  = "succeeded"
+	AIJobFailed     = "failed"
+	AIJobCancelled  = "cancelled"
+)
+
+// AIJobCancellableStatuses are the states a job can be cancelled from: the
+// worker has not picked it up yet.
+var AIJobCancellableStatuses = []string{AIJobPending, AIJobQueued}
+
+// AIJobOpenStatuses are the states a job can still leave.
+var AIJobOpenStatuses = []string{AIJobPending, AIJobQueued, AIJobProcessing}
+
+// AIJob tracks one image analysis request from upload to result.
+type AIJob struct {
+	ID        string       `bson:"_id" json:"id"`
+	TenantID  string       `bson:"tenant_id" json:"tenant_id"`
+	UserID    string       `bson:"user_id" json:"user_id"`
+	Status    string       `bson:"status" json:"status"`
+	Priority  string       `bson:"priority,omitempty" json:"priority,omitempty"` // interactive or bulk
+	BatchID   string       `bson:"batch_id,omitempty" json:"batch_id,omitempty"`
+	FileName  string       `bson:"file_name,omitempty" json:"file_name,omitempty"`
+	ImageHash string       `bson:"image_hash,omitempty" json:"image_hash,omitempty"` // perceptual hash (hex dHash) to spot re-uploads
+	ImageID   string       `bson:"image_id,omitempty" json:"image_id,omitempty"`
+	ImageURL  string       `bson:"image_url" json:"image_url"`
+	ImageKey  string       `bson:"image_key" json:"image_key"`
+	Error     string       `bson:"error,omitempty" json:"error,omitempty"`
+	Result    *AIJobResult `bson:"result,omitempty" json:"result,omitempty"`
+
+	// Failed attempts so far; once it reaches the retry policy's maximum
+	// the job is dead-lettered.
+	Attempts      int        `bson:"attempts" json:"attempts"`
+	NextAttemptAt *time.Time `bson:"next_attempt_at,omitempty" json:"next_attempt_at,omitempty"`
+	DeadLettered  bool       `bson:"dead_lettered,omitempty" json:"dead_lettered,omitempty"`
+
+	// The current run and the settings it was started with; empty settings
+	// mean the worker's defaults. Runs holds every earlier run of the job.
+	Run                 int        `bson:"run,omitempty" json:"run,omitempty"`
+	ModelVersion        string     `bson:"model_version,omitempty" json:"model_version,omitempty"`
+	ConfidenceThreshold float64    `bson:"confidence_threshold,omitempty" json:"confidence_threshold,omitempty"`
+	Runs                []AIJobRun `bson:"runs,omitempty" json:"runs,omitempty"`
+	CancelledAt         *time.Time `bson:"cancelled_at,omitempty" json:"cancelled_at,omitempty"`
+
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time  `bson:"updated_at" json:"updated_at"`
+	StartedAt  *time.Time `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	FinishedAt *time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+
+	// Review of the draft items created from Result.
+	Reviews    []AIJobReview `bson:"reviews,omitempty" json:"reviews,omitempty"`
+	ReviewedAt *time.Time    `bson:"reviewed_at,omitempty" json:"reviewed_at,omitempty"`
+}
+
+// AIBatch groups the jobs created from one multi-image upload.
+type AIBatch struct {
+	ID        string        `bson:"_id" json:"id"`
+	TenantID  string        `bson:"tenant_id" json:"tenant_id"`
+	UserID    string        `bson:"user_id" json:"user_id"`
+	Priority  string        `bson:"priority" json:"priority"`
+	JobIDs    []string      `bson:"job_ids" json:"job_ids"`
+	Rejected  []AIBatchFile `bson:"rejected,omitempty" json:"rejected,omitempty"` // files that were not queued
+	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+}
+
+// AIBatchFile is an uploaded file of a batch that could not be queued.
+type AIBatchFile struct {
+	Name        string `bson:"name" json:"name"`
+	Error       string `bson:"error" json:"error"`
+	DuplicateOf string `bson:"duplicate_of,omitempty" json:"duplicate_of,omitempty"`
+}
+
+// AIJobRun is the outcome of one finished run of a job, archived when the
+// job is re-run.
+type AIJobRun struct {
+	Run                 int          `bson:"run" json:"run"`
+	ModelVersion        string       `bson:"model_version,omitempty" json:"model_version,omitempty"`
+	ConfidenceThreshold float64      `bson:"confidence_threshold,omitempty" json:"confidence_threshold,omitempty"`
+	Status              string       `bson:"status" json:"status"`
+	Error               string       `bson:"error,omitempty" json:"error,omitempty"`
+	Result              *AIJobResult `bson:"result,omitempty" json:"result,omitempty"`
+	Attempts            int          `bson:"attempts" json:"attempts"`
+	StartedAt           *time.Time   `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	FinishedAt          *time.Time   `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// Review actions on a detected draft item.
+const (
+	AIReviewApproved = "approved"
+	AIReviewMerged   = "merged"
+	AIReviewRejected = "rejected"
+)
+
+// AIJobReview records what a user decided for one detected item.
+type AIJobReview struct {
+	ItemID     primitive.ObjectID  `bson:"item_id" json:"item_id"`
+	Action     string              `bson:"action" json:"action"`
+	MergedInto *primitive.ObjectID `bson:"merged_into,omitempty" json:"merged_into,omitempty"`
+	Quantity   float64             `bson:"quantity" json:"quantity"`
+	UserID     string              `bson:"user_id" json:"user_id"`
+	At         time.Time           `bson:"at" json:"at"`
+}
+
+// AIJobResult is the payload reported back by the AI worker.
+type AIJobResult struct {
+	Detections []AIDetection `bson:"detections" json:"detections"`
+	RawText    string        `bson:"raw_text" json:"raw_text"`
+	Model      string        `bson:"model" json:"model"`
+}
+
+type AIDetection struct {
+	Name       string  `bson:"name" json:"name"`
+	Quantity   float64 `bson:"quantity" json:"quantity"`
+	Confidence float64 `bson:"confidence" json:"confidence"`
+}
+
+// AIDeadLetter keeps a job message that exhausted its retries (or could not
+// be parsed at all) so an admin can inspect, requeue or purge it.
+type AIDeadLetter struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID  string             `bson:"tenant_id" json:"tenant_id"`
+	JobID     string             `bson:"job_id,omitempty" json:"job_id,omitempty"`
+	Payload   string             `bson:"payload" json:"payload"` // raw message body
+	Attempts  int                `bson:"attempts" json:"attempts"`
+	Reason    string             `bson:"reason" json:"reason"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 }
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// OutboxEvent is a message waiting to be published to RabbitMQ. It is
+// written in the same transaction as the change it describes, in Postgres
+// (outbox_events table) or MongoDB (outbox collection) depending on where
+// that change lives, and shipped later by the outbox relay.
+type OutboxEvent struct {
+	ID          string     `gorm:"type:uuid;primaryKey" bson:"_id" json:"id"` // also the AMQP message id, for dedupe
+	TenantID    string     `gorm:"index" bson:"tenant_id" json:"tenant_id"`
+	Type        string     `gorm:"not null" bson:"type" json:"type"` // e.g. item.updated, ai.job.queued
+	Exchange    string     `bson:"exchange" json:"exchange"`
+	RoutingKey  string     `gorm:"not null" bson:"routing_key" json:"routing_key"`
+	Payload     string     `gorm:"type:jsonb;not null" bson:"payload" json:"payload"`
+	Priority    uint8      `gorm:"not null;default:0" bson:"priority,omitempty" json:"priority,omitempty"`
+	Attempts    int        `gorm:"not null;default:0" bson:"attempts" json:"attempts"`
+	LastError   string     `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	AvailableAt time.Time  `gorm:"index" bson:"available_at" json:"available_at"` // not picked up before this
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	PublishedAt *time.Time `gorm:"index" bson:"published_at" json:"published_at,omitempty"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "outbox_events"
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Serial unit states. Units in stock, reserved or returned are on hand and
+// count towards their item's quantity; units in transit are on a transfer
+// between warehouses.
+const (
+	SerialInStock   = "in_stock"
+	SerialReserved  = "reserved"
+	SerialShipped   = "shipped"
+	SerialReturned  = "returned"
+	SerialScrapped  = "scrapped"
+	SerialInTransit = "in_transit"
+)
+
+// SerialOnHandStatuses are the states of units counted in stock.
+var SerialOnHandStatuses = []string{SerialInStock, SerialReserved, SerialReturned}
+
+// SerialUnit is one individually tracked unit of a serialized item. Serial
+// numbers are unique within a tenant.
+type SerialUnit struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID    string             `bson:"tenant_id" json:"tenant_id"`
+	Serial      string             `bson:"serial" json:"serial"`
+	ItemID      primitive.ObjectID `bson:"item_id" json:"item_id"`
+	WarehouseID string             `bson:"warehouse_id,omitempty" json:"warehouse_id,omitempty"`
+	SKU         string             `bson:"sku,omitempty" json:"sku,omitempty"`
+	Status      string             `bson:"status" json:"status"`
+	History     []SerialEvent      `bson:"history" json:"history"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// SerialEvent is one step in a unit's history: the state it entered and
+// where it was at that point.
+type SerialEvent struct {
+	At          time.Time          `bson:"at" json:"at"`
+	Status      string             `bson:"status" json:"status"`
+	ItemID      primitive.ObjectID `bson:"item_id" json:"item_id"`
+	WarehouseID string             `bson:"warehouse_id,omitempty" json:"warehouse_id,omitempty"`
+	MovementID  primitive.ObjectID `bson:"movement_id,omitempty" json:"movement_id,omitempty"`
+	Reason      string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	Reference   string             `bson:"reference,omitempty" json:"reference,omitempty"`
+	UserID      string             `bson:"user_id,omitempty" json:"user_id,omitempty"`
+}
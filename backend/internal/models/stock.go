@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Stock movement types. Receipts and AI scans add stock, issues remove it,
+// adjustments correct it either way and transfers move it between items
+// (one movement out of the source, one into the destination).
+const (
+	MovementReceipt    = "receipt"
+	MovementIssue      = "issue"
+	MovementAdjustment = "adjustment"
+	MovementTransfer   = "transfer"
+	MovementAIScan     = "ai_scan"
+)
+
+// StockMovement is one entry of the append-only stock ledger. An item's
+// Quantity is the sum of its movements' Quantity.
+type StockMovement struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID    string             `bson:"tenant_id" json:"tenant_id"`
+	ItemID      primitive.ObjectID `bson:"item_id" json:"item_id"`
+	WarehouseID string             `bson:"warehouse_id,omitempty" json:"warehouse_id,omitempty"`
+	Type        string             `bson:"type" json:"type"`
+	Quantity    float64            `bson:"quantity" json:"quantity"` // signed change, in the item's unit
+	Balance     float64            `bson:"balance" json:"balance"`   // item quantity after this movement
+	Reason      string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	Reference   string             `bson:"reference,omitempty" json:"reference,omitempty"` // e.g. PO, order or job id
+	TransferID  string             `bson:"transfer_id,omitempty" json:"transfer_id,omitempty"`
+	Lots        []LotAllocation    `bson:"lots,omitempty" json:"lots,omitempty"`       // lots the quantity went into or came from
+	Serials     []string           `bson:"serials,omitempty" json:"serials,omitempty"` // units moved, for serialized items
+	Entered     *Measure           `bson:"entered,omitempty" json:"entered,omitempty"` // quantity as given, when in another unit
+	UserID      string             `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// StockLot is the stock of an item received under one lot (batch) number.
+// An item's lots add up to at most its quantity; the rest is stock that
+// was never received into a lot.
+type StockLot struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID    string             `bson:"tenant_id" json:"tenant_id"`
+	ItemID      primitive.ObjectID `bson:"item_id" json:"item_id"`
+	WarehouseID string             `bson:"warehouse_id,omitempty" json:"warehouse_id,omitempty"`
+	LotNumber   string             `bson:"lot_number" json:"lot_number"`
+	ExpiryDate  *time.Time         `bson:"expiry_date,omitempty" json:"expiry_date,omitempty"`
+	Quantity    float64            `bson:"quantity" json:"quantity"`
+	ReceivedAt  time.Time          `bson:"received_at" json:"received_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// LotAllocation is the part of a movement's quantity that went into or
+// came out of one lot. Quantity is always positive.
+type LotAllocation struct {
+	LotID      primitive.ObjectID `bson:"lot_id,omitempty" json:"lot_id,omitempty"`
+	LotNumber  string             `bson:"lot_number" json:"lot_number"`
+	ExpiryDate *time.Time         `bson:"expiry_date,omitempty" json:"expiry_date,omitempty"`
+	Quantity   float64            `bson:"quantity" json:"quantity"`
+}
+
+// Measure is a quantity in a unit.
+type Measure struct {
+	Quantity float64 `bson:"quantity" json:"quantity"`
+	Unit     string  `bson:"unit" json:"unit"`
+}
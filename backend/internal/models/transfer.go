@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+)
+
+// Stock transfer states. Drafts can still be edited; dispatching takes the
+// stock out of the source warehouse and receiving puts it into the
+// destination. Drafts and transfers in transit can be cancelled, the latter
+// returning the stock to the source.
+const (
+	TransferDraft     = "draft"
+	TransferInTransit = "in_transit"
+	TransferReceived  = "received"
+	TransferCancelled = "cancelled"
+)
+
+// StockTransfer moves stock of one or more SKUs between two warehouses.
+type StockTransfer struct {
+	ID                     string         `bson:"_id" json:"id"`
+	TenantID               string         `bson:"tenant_id" json:"tenant_id"`
+	SourceWarehouseID      string         `bson:"source_warehouse_id" json:"source_warehouse_id"`
+	DestinationWarehouseID string         `bson:"destination_warehouse_id" json:"destination_warehouse_id"`
+	Status                 string         `bson:"status" json:"status"`
+	Lines                  []TransferLine `bson:"lines" json:"lines"`
+	Note                   string         `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedBy              string         `bson:"created_by" json:"created_by"`
+	CreatedAt              time.Time      `bson:"created_at" json:"created_at"`
+	UpdatedAt              time.Time      `bson:"updated_at" json:"updated_at"`
+	DispatchedAt           *time.Time     `bson:"dispatched_at,omitempty" json:"dispatched_at,omitempty"`
+	ReceivedAt             *time.Time     `bson:"received_at,omitempty" json:"received_at,omitempty"`
+	CancelledAt            *time.Time     `bson:"cancelled_at,omitempty" json:"cancelled_at,omitempty"`
+}
+
+// TransferLine is the quantity of one SKU being transferred. The item ids
+// are filled in when the line is dispatched and received, when Quantity is
+// also converted to the source item's unit.
+type TransferLine struct {
+	SKU               string  `bson:"sku" json:"sku"`
+	Quantity          float64 `bson:"quantity" json:"quantity"`
+	Unit              string  `bson:"unit,omitempty" json:"unit,omitempty"` // of Quantity; the source item's unit once dispatched
+	SourceItemID      string  `bson:"source_item_id,omitempty" json:"source_item_id,omitempty"`
+	DestinationItemID string  `bson:"destination_item_id,omitempty" json:"destination_item_id,omitempty"`
+
+	// Lots the stock was taken from at dispatch; it is received into the
+	// same lots at the destination.
+	Lots []LotAllocation `bson:"lots,omitempty" json:"lots,omitempty"`
+	// Serial numbers of the units moved; required for serialized items.
+	Serials []string `bson:"serials,omitempty" json:"serials,omitempty"`
+}
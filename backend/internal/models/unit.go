@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultUnit is the base unit of items that do not name one.
+const DefaultUnit = "pcs"
+
+// Unit is a unit of measure. A unit is either a base of its own (BaseCode
+// empty) or defined as Factor of another unit, e.g. 1 box = 24 pcs; two
+// units convert into each other when they lead back to the same base.
+// Tenants add their own units to the StandardUnits.
+type Unit struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	TenantID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_unit_code" json:"tenant_id"`
+	Code      string    `gorm:"not null;uniqueIndex:idx_unit_code" json:"code"`
+	Name      string    `json:"name"`
+	BaseCode  string    `json:"base_code,omitempty"`
+	Factor    float64   `gorm:"not null;default:1" json:"factor"` // 1 of this unit = Factor of BaseCode
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Standard bool `gorm:"-" json:"standard,omitempty"`
+}
+
+func (Unit) TableName() string {
+	return "units"
+}
+
+func (u *Unit) BeforeCreate(tx *gorm.DB) (err error) {
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	return
+}
+
+// StandardUnits are available to every tenant and cannot be changed.
+var StandardUnits = []Unit{
+	{Code: "pcs", Name: "pieces", Factor: 1, Standard: true},
+	{Code: "dozen", Name: "dozen", BaseCode: "pcs", Factor: 12, Standard: true},
+	{Code: "kg", Name: "kilogram", Factor: 1, Standard: true},
+	{Code: "g", Name: "gram", BaseCode: "kg", Factor: 0.001, Standard: true},
+	{Code: "t", Name: "tonne", BaseCode: "kg", Factor: 1000, Standard: true},
+	{Code: "l", Name: "litre", Factor: 1, Standard: true},
+	{Code: "ml", Name: "millilitre", BaseCode: "l", Factor: 0.001, Standard: true},
+	{Code: "m", Name: "metre", Factor: 1, Standard: true},
+	{Code: "cm", Name: "centimetre", BaseCode: "m", Factor: 0.01, Standard: true},
+}
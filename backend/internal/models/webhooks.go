@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebhookSubscription is a tenant's endpoint for domain events. Payloads are
+// signed with Secret, which is only returned when the subscription is
+// created.
+type WebhookSubscription struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	TenantID    uuid.UUID `gorm:"type:uuid;not null;index" json:"tenant_id"`
+	URL         string    `gorm:"not null" json:"url"`
+	Secret      string    `gorm:"not null" json:"-"`
+	EventTypes  []string  `gorm:"type:jsonb;serializer:json;not null" json:"event_types"` // "*" matches every event
+	Description string    `json:"description"`
+	Active      bool      `gorm:"not null;default:true" json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (WebhookSubscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+func (s *WebhookSubscription) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return
+}
+
+// Wants reports whether the subscription is for events of eventType.
+func (s *WebhookSubscription) Wants(eventType string) bool {
+	for _, t := range s.EventTypes {
+		if t == "*" || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook delivery states.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed" // gave up after the last attempt
+)
+
+// WebhookDelivery is one event sent (or to be sent) to one subscription,
+// with a log of every attempt.
+type WebhookDelivery struct {
+	ID             uuid.UUID        `gorm:"type:uuid;primaryKey" json:"id"`
+	TenantID       uuid.UUID        `gorm:"type:uuid;not null" json:"tenant_id"`
+	SubscriptionID uuid.UUID        `gorm:"type:uuid;not null;uniqueIndex:idx_webhook_delivery_event;index:idx_webhook_delivery_sub,priority:1" json:"subscription_id"`
+	EventID        string           `gorm:"not null;uniqueIndex:idx_webhook_delivery_event" json:"event_id"`
+	EventType      string           `gorm:"not null" json:"event_type"`
+	Payload        string           `gorm:"type:jsonb;not null" json:"payload"` // the exact body sent
+	Status         string           `gorm:"not null;index:idx_webhook_delivery_due,priority:1" json:"status"`
+	Attempts       int              `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time        `gorm:"index:idx_webhook_delivery_due,priority:2" json:"next_attempt_at"`
+	Log            []WebhookAttempt `gorm:"type:jsonb;serializer:json" json:"log"`
+	CreatedAt      time.Time        `gorm:"index:idx_webhook_delivery_sub,priority:2" json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+	DeliveredAt    *time.Time       `json:"delivered_at,omitempty"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) (err error) {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return
+}
+
+// WebhookAttempt records one HTTP attempt of a delivery.
+type WebhookAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Response   string    `json:"response,omitempty"` // start of the response body
+	DurationMS int64     `json:"duration_ms"`
+}
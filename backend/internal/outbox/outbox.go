@@ -0,0 +1,142 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/queue"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+)
+
+// Outbox writes events alongside the changes they describe so that a change
+// and its event either both happen or neither does.
+type Outbox struct {
+	PG    *gorm.DB
+	Mongo *mongo.Database
+}
+
+// ErrNoMongoTransactions is returned by New when MongoDB is a standalone
+// server. Changes and their events could then not be written atomically,
+// so the backend does not start; run MongoDB as a (single-node) replica
+// set instead.
+var ErrNoMongoTransactions = errors.New("MongoDB does not support transactions; run it as a replica set (mongod --replSet)")
+
+// New returns an outbox writing to pg and mongoDb. MongoDB must support
+// transactions, i.e. be a replica set member or a mongos.
+func New(ctx context.Context, pg *gorm.DB, mongoDb *mongo.Database) (*Outbox, error) {
+	var hello bson.M
+	if err := mongoDb.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return nil, err
+	}
+	if _, replicaSet := hello["setName"]; !replicaSet && hello["msg"] != "isdbgrid" {
+		return nil, ErrNoMongoTransactions
+	}
+	return &Outbox{PG: pg, Mongo: mongoDb}, nil
+}
+
+func (o *Outbox) collection() *mongo.Collection {
+	return o.Mongo.Collection("outbox")
+}
+
+// EnsureIndexes creates the index the relay polls on.
+func (o *Outbox) EnsureIndexes(ctx context.Context) error {
+	_, err := o.collection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "published_at", Value: 1}, {Key: "available_at", Value: 1}},
+	})
+	return err
+}
+
+// NewEvent builds a domain event for the inventory events exchange, routed
+// by its type.
+func NewEvent(tenantID, eventType string, payload interface{}) (models.OutboxEvent, error) {
+	return newEvent(tenantID, eventType, queue.EventsExchange, eventType, payload)
+}
+
+// NewJobEvent builds the message that hands an AI job to the worker queue.
+func NewJobEvent(job queue.AIJob) (models.OutboxEvent, error) {
+	ev, err := newEvent(job.TenantID, JobQueuedEvent, "", queue.ImageQueue, job)
+	ev.Priority = job.Priority
+	return ev, err
+}
+
+// JobQueuedEvent is the type of events built by NewJobEvent.
+const JobQueuedEvent = "ai.job.queued"
+
+func newEvent(tenantID, eventType, exchange, key string, payload interface{}) (models.OutboxEvent, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return models.OutboxEvent{}, err
+	}
+	now := time.Now()
+	return models.OutboxEvent{
+		ID:          uuid.NewString(),
+		TenantID:    tenantID,
+		Type:        eventType,
+		Exchange:    exchange,
+		RoutingKey:  key,
+		Payload:     string(body),
+		AvailableAt: now,
+		CreatedAt:   now,
+	}, nil
+}
+
+// AddPG stores events using tx, the caller's Postgres transaction.
+func (o *Outbox) AddPG(tx *gorm.DB, events ...models.OutboxEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return tx.Create(&events).Error
+}
+
+// AddMongo stores events in the outbox collection. Pass the context given
+// to RunMongo so the insert joins its transaction.
+func (o *Outbox) AddMongo(ctx context.Context, events ...models.OutboxEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(events))
+	for i := range events {
+		docs[i] = events[i]
+	}
+	_, err := o.collection().InsertMany(ctx, docs)
+	return err
+}
+
+// EmitPG builds a domain event and stores it in tx.
+func (o *Outbox) EmitPG(tx *gorm.DB, tenantID, eventType string, payload interface{}) error {
+	ev, err := NewEvent(tenantID, eventType, payload)
+	if err != nil {
+		return err
+	}
+	return o.AddPG(tx, ev)
+}
+
+// EmitMongo builds a domain event and stores it in the outbox collection.
+func (o *Outbox) EmitMongo(ctx context.Context, tenantID, eventType string, payload interface{}) error {
+	ev, err := NewEvent(tenantID, eventType, payload)
+	if err != nil {
+		return err
+	}
+	return o.AddMongo(ctx, ev)
+}
+
+// RunMongo runs fn inside a MongoDB transaction, retrying on transient
+// transaction errors.
+func (o *Outbox) RunMongo(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := o.Mongo.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
@@ -0,0 +1,171 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/queue"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	pollInterval = time.Second
+	batchSize    = 100
+	// lease is how long a claimed event is hidden from other relays while
+	// it is being published; if this relay dies it is picked up again.
+	lease = 30 * time.Second
+	// retention is how long published events are kept before cleanup.
+	retention = 7 * 24 * time.Hour
+)
+
+// Relay ships pending outbox events to RabbitMQ. Delivery is at-least-once:
+// an event is marked published only after the broker confirms it, so a
+// crash in between republishes it with the same message id.
+type Relay struct {
+	Outbox *Outbox
+	Broker queue.Broker
+
+	// OnPublished, if set, is called after each event is confirmed.
+	OnPublished func(ctx context.Context, ev models.OutboxEvent)
+}
+
+// Run polls both stores until ctx is cancelled. Several replicas may run a
+// relay at once; claims are leased so each event is normally sent once.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !r.Broker.Connected() {
+			continue
+		}
+
+		r.relayPG(ctx)
+		r.relayMongo(ctx)
+
+		if time.Since(lastCleanup) > time.Hour {
+			r.cleanup(ctx)
+			lastCleanup = time.Now()
+		}
+	}
+}
+
+func (r *Relay) relayPG(ctx context.Context) {
+	now := time.Now()
+	var events []models.OutboxEvent
+	err := r.Outbox.PG.WithContext(ctx).Raw(`
+		UPDATE outbox_events SET available_at = ?
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE published_at IS NULL AND available_at <= ?
+			ORDER BY created_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, now.Add(lease), now, batchSize).Scan(&events).Error
+	if err != nil {
+		log.Printf("outbox: claim postgres events failed: %v", err)
+		return
+	}
+
+	for _, ev := range events {
+		err := r.publish(ctx, ev)
+		updates := map[string]interface{}{}
+		if err != nil {
+			updates["attempts"] = ev.Attempts + 1
+			updates["last_error"] = err.Error()
+			updates["available_at"] = time.Now().Add(backoff(ev.Attempts + 1))
+		} else {
+			updates["published_at"] = time.Now()
+		}
+		if err := r.Outbox.PG.WithContext(ctx).Model(&models.OutboxEvent{}).Where("id = ?", ev.ID).Updates(updates).Error; err != nil {
+			log.Printf("outbox: update postgres event %s failed: %v", ev.ID, err)
+		}
+	}
+}
+
+func (r *Relay) relayMongo(ctx context.Context) {
+	coll := r.Outbox.collection()
+	for i := 0; i < batchSize; i++ {
+		now := time.Now()
+		var ev models.OutboxEvent
+		err := coll.FindOneAndUpdate(ctx,
+			bson.M{"published_at": nil, "available_at": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"available_at": now.Add(lease)}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+		).Decode(&ev)
+		if err == mongo.ErrNoDocuments {
+			return
+		}
+		if err != nil {
+			log.Printf("outbox: claim mongo event failed: %v", err)
+			return
+		}
+
+		var update bson.M
+		if err := r.publish(ctx, ev); err != nil {
+			update = bson.M{"$set": bson.M{
+				"attempts":     ev.Attempts + 1,
+				"last_error":   err.Error(),
+				"available_at": time.Now().Add(backoff(ev.Attempts + 1)),
+			}}
+		} else {
+			update = bson.M{"$set": bson.M{"published_at": time.Now()}}
+		}
+		if _, err := coll.UpdateOne(ctx, bson.M{"_id": ev.ID}, update); err != nil {
+			log.Printf("outbox: update mongo event %s failed: %v", ev.ID, err)
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, ev models.OutboxEvent) error {
+	pubCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := r.Broker.Publish(pubCtx, queue.Message{
+		Exchange:   ev.Exchange,
+		RoutingKey: ev.RoutingKey,
+		MessageID:  ev.ID,
+		Priority:   ev.Priority,
+		Headers:    map[string]interface{}{queue.TenantHeader: ev.TenantID},
+		Body:       []byte(ev.Payload),
+	})
+	if err != nil {
+		log.Printf("outbox: publish %s %s failed: %v", ev.Type, ev.ID, err)
+		return err
+	}
+	if r.OnPublished != nil {
+		r.OnPublished(ctx, ev)
+	}
+	return nil
+}
+
+func (r *Relay) cleanup(ctx context.Context) {
+	cutoff := time.Now().Add(-retention)
+	if err := r.Outbox.PG.WithContext(ctx).Where("published_at < ?", cutoff).Delete(&models.OutboxEvent{}).Error; err != nil {
+		log.Printf("outbox: cleanup postgres failed: %v", err)
+	}
+	if _, err := r.Outbox.collection().DeleteMany(ctx, bson.M{"published_at": bson.M{"$lt": cutoff}}); err != nil {
+		log.Printf("outbox: cleanup mongo failed: %v", err)
+	}
+}
+
+// backoff delays the next attempt of a failing event: 2s, 4s, 8s, ... up to
+// five minutes.
+func backoff(attempts int) time.Duration {
+	d := time.Second << attempts
+	if d <= 0 || d > 5*time.Minute {
+		return 5 * time.Minute
+	}
+	return d
+}
@@ -0,0 +1,321 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Reconnect backoff bounds for the AMQP connection.
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// consumerPrefetch bounds unacked deliveries per consumer.
+const consumerPrefetch = 10
+
+// AMQPBroker talks to RabbitMQ. Publishes use publisher confirms: a publish
+// only succeeds once the broker has acked the message. It keeps
+// reconnecting in the background after the connection is lost (or was
+// never established) and is safe for concurrent use.
+type AMQPBroker struct {
+	url      string
+	topology Topology
+
+	mu      sync.RWMutex // guards conn and channel
+	conn    *amqp.Connection
+	channel *amqp.Channel // publishing channel, in confirm mode
+
+	done chan struct{}
+}
+
+// NewAMQPBroker starts connecting to url in the background and returns
+// immediately; publishes fail with ErrNotConnected until the first
+// connection is up.
+func NewAMQPBroker(url string, policy RetryPolicy) *AMQPBroker {
+	b := &AMQPBroker{url: url, topology: NewTopology(policy), done: make(chan struct{})}
+	go b.maintain()
+	return b
+}
+
+// maintain (re)connects with exponential backoff until Close is called.
+func (b *AMQPBroker) maintain() {
+	delay := minReconnectDelay
+	for {
+		closed, err := b.connect()
+		if err != nil {
+			log.Printf("queue: connect failed, retrying in %s: %v", delay, err)
+			select {
+			case <-b.done:
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+			continue
+		}
+
+		log.Println("queue: connected to RabbitMQ")
+		delay = minReconnectDelay
+
+		select {
+		case <-b.done:
+			return
+		case err := <-closed:
+			log.Printf("queue: connection lost: %v", err)
+		}
+
+		b.mu.Lock()
+		if b.conn != nil {
+			b.conn.Close()
+			b.conn, b.channel = nil, nil
+		}
+		b.mu.Unlock()
+	}
+}
+
+// connect dials, declares the topology and puts the publishing channel in
+// confirm mode. The returned channel fires when either connection or
+// channel dies.
+func (b *AMQPBroker) connect() (<-chan *amqp.Error, error) {
+	conn, err := amqp.Dial(b.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to rabbitmq: %v", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open channel: %v", err)
+	}
+	if err := declareTopology(ch, b.topology); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := migrateLegacyImageQueue(conn); err != nil {
+		log.Printf("queue: migrating %s failed, retrying on the next connect: %v", LegacyImageQueue, err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %v", err)
+	}
+
+	closed := make(chan *amqp.Error, 1)
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		select {
+		case err := <-connClosed:
+			closed <- err
+		case err := <-chClosed:
+			closed <- err
+		}
+	}()
+
+	b.mu.Lock()
+	b.conn, b.channel = conn, ch
+	b.mu.Unlock()
+	return closed, nil
+}
+
+// declareTopology declares every exchange, queue and binding of t.
+func declareTopology(ch *amqp.Channel, t Topology) error {
+	for _, ex := range t.Exchanges {
+		if err := ch.ExchangeDeclare(ex.Name, ex.Kind, true, false, false, false, nil); err != nil {
+			return fmt.Errorf("failed to declare exchange %s: %v", ex.Name, err)
+		}
+	}
+	for _, q := range t.Queues {
+		if _, err := ch.QueueDeclare(q.Name, true, false, false, false, queueArgs(q)); err != nil {
+			return fmt.Errorf("failed to declare queue %s: %v", q.Name, err)
+		}
+		for _, bind := range q.Bindings {
+			if err := ch.QueueBind(q.Name, bind.Key, bind.Exchange, false, nil); err != nil {
+				return fmt.Errorf("failed to bind queue %s: %v", q.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// queueArgs translates a QueueSpec into RabbitMQ x-arguments. They must
+// match what the Python worker declares for the queues it shares.
+func queueArgs(q QueueSpec) amqp.Table {
+	args := amqp.Table{}
+	if q.DeadLetterExchange != nil {
+		args["x-dead-letter-exchange"] = *q.DeadLetterExchange
+		args["x-dead-letter-routing-key"] = q.DeadLetterKey
+	}
+	if q.MessageTTL > 0 {
+		args["x-message-ttl"] = q.MessageTTL.Milliseconds()
+	}
+	if q.MaxPriority > 0 {
+		args["x-max-priority"] = int32(q.MaxPriority)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+func (b *AMQPBroker) Connected() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.channel != nil
+}
+
+// Publish sends one persistent message and waits for the broker's confirm.
+func (b *AMQPBroker) Publish(ctx context.Context, msg Message) error {
+	b.mu.RLock()
+	ch := b.channel
+	b.mu.RUnlock()
+	if ch == nil {
+		return ErrNotConnected
+	}
+
+	// amqp091 serialises frames per channel and tracks a deferred confirm
+	// per publish, so concurrent callers can share the channel and wait for
+	// their own confirms independently.
+	dc, err := ch.PublishWithDeferredConfirmWithContext(ctx,
+		msg.Exchange,   // exchange
+		msg.RoutingKey, // routing key
+		false,          // mandatory
+		false,          // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    msg.MessageID,
+			Priority:     msg.Priority,
+			Headers:      amqp.Table(msg.Headers),
+			Body:         msg.Body,
+		})
+	if err != nil {
+		return err
+	}
+
+	acked, err := dc.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return ErrNacked
+	}
+	return nil
+}
+
+// Consume opens its own channel on the shared connection and re-registers
+// after every reconnect until ctx is cancelled.
+func (b *AMQPBroker) Consume(ctx context.Context, queue string, handle Handler) error {
+	for {
+		err := b.consumeOnce(ctx, queue, handle)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && err != ErrNotConnected {
+			log.Printf("queue: consumer on %s stopped: %v", queue, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.done:
+			return fmt.Errorf("broker closed")
+		case <-time.After(minReconnectDelay):
+		}
+	}
+}
+
+func (b *AMQPBroker) consumeOnce(ctx context.Context, queue string, handle Handler) error {
+	b.mu.RLock()
+	conn := b.conn
+	b.mu.RUnlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %v", err)
+	}
+	defer ch.Close()
+
+	if err := ch.Qos(consumerPrefetch, 0, false); err != nil {
+		return fmt.Errorf("failed to set qos: %v", err)
+	}
+	msgs, err := ch.Consume(
+		queue, // queue
+		"",    // consumer
+		false, // auto-ack
+		false, // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,   // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register consumer: %v", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-msgs:
+			if !ok {
+				return fmt.Errorf("delivery channel closed")
+			}
+			handle(ctx, &Delivery{
+				Message: Message{
+					Exchange:   d.Exchange,
+					RoutingKey: d.RoutingKey,
+					MessageID:  d.MessageId,
+					Priority:   d.Priority,
+					Headers:    plainHeaders(d.Headers),
+					Body:       d.Body,
+				},
+				Redelivered: d.Redelivered,
+				ack:         func() error { return d.Ack(false) },
+				nack:        func(requeue bool) error { return d.Nack(false, requeue) },
+			})
+		}
+	}
+}
+
+// plainHeaders converts AMQP headers, including nested tables such as
+// x-death, into plain maps so consumers need not know about amqp.Table.
+func plainHeaders(t amqp.Table) map[string]interface{} {
+	out := make(map[string]interface{}, len(t))
+	for k, v := range t {
+		out[k] = plainValue(v)
+	}
+	return out
+}
+
+func plainValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case amqp.Table:
+		return plainHeaders(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i := range v {
+			out[i] = plainValue(v[i])
+		}
+		return out
+	}
+	return v
+}
+
+// Close stops reconnecting and closes the current connection.
+func (b *AMQPBroker) Close() {
+	close(b.done)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn != nil {
+		b.conn.Close()
+		b.conn, b.channel = nil, nil
+	}
+}
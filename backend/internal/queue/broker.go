@@ -0,0 +1,176 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotConnected is returned while a broker is (re)connecting.
+	ErrNotConnected = errors.New("queue broker not connected")
+	// ErrNacked is returned when the broker refuses a message.
+	ErrNacked = errors.New("message nacked by broker")
+)
+
+// Broker is the messaging backend: RabbitMQ in production (AMQPBroker) or
+// an in-process MemoryBroker for tests and single-node deployments. Both
+// implement the same Topology.
+type Broker interface {
+	// Publish routes msg like RabbitMQ would: an empty Exchange delivers to
+	// the queue named by RoutingKey. It returns once the message is stored.
+	Publish(ctx context.Context, msg Message) error
+
+	// Consume delivers messages from queue to handle until ctx is
+	// cancelled, surviving reconnects. handle must Ack or Nack each
+	// delivery.
+	Consume(ctx context.Context, queue string, handle Handler) error
+
+	// Connected reports whether Publish can currently succeed.
+	Connected() bool
+
+	Close()
+}
+
+// Message is a broker-agnostic message.
+type Message struct {
+	Exchange   string
+	RoutingKey string
+	MessageID  string // set by producers for consumer-side dedupe
+	Priority   uint8  // only honoured by queues with a MaxPriority
+	Headers    map[string]interface{}
+	Body       []byte
+}
+
+// Delivery is a consumed Message awaiting acknowledgement.
+type Delivery struct {
+	Message
+	Redelivered bool
+
+	ack  func() error
+	nack func(requeue bool) error
+}
+
+func (d *Delivery) Ack() error {
+	return d.ack()
+}
+
+// Nack rejects the delivery. With requeue false the message is
+// dead-lettered if its queue has a dead-letter exchange, else dropped.
+func (d *Delivery) Nack(requeue bool) error {
+	return d.nack(requeue)
+}
+
+type Handler func(ctx context.Context, d *Delivery)
+
+// Exchange kinds used by the topology.
+const (
+	ExchangeDirect = "direct"
+	ExchangeTopic  = "topic"
+)
+
+type ExchangeSpec struct {
+	Name string
+	Kind string
+}
+
+type Binding struct {
+	Exchange string
+	Key      string
+}
+
+// QueueSpec describes one durable queue. Expired and rejected messages go
+// to DeadLetterExchange with DeadLetterKey (an empty exchange name means
+// the default exchange, i.e. straight to the queue named DeadLetterKey).
+type QueueSpec struct {
+	Name               string
+	DeadLetterExchange *string
+	DeadLetterKey      string
+	MessageTTL         time.Duration
+	MaxPriority        uint8 // 0 means a plain FIFO queue
+	Bindings           []Binding
+}
+
+// Topology is the full set of exchanges and queues the backend relies on.
+type Topology struct {
+	Exchanges []ExchangeSpec
+	Queues    []QueueSpec
+}
+
+// NewTopology builds the topology for a retry policy: the events exchange
+// and the webhook and stock alert queues bound to it, the image queue with
+// its dead-letter exchange and failed queue, one delay queue per retry, and
+// the results queue.
+func NewTopology(policy RetryPolicy) Topology {
+	defaultExchange := ""
+	dlx := DeadLetterExchange
+
+	t := Topology{
+		Exchanges: []ExchangeSpec{
+			{Name: DeadLetterExchange, Kind: ExchangeDirect},
+			{Name: EventsExchange, Kind: ExchangeTopic},
+		},
+		Queues: []QueueSpec{
+			{Name: ImageQueue, DeadLetterExchange: &dlx, DeadLetterKey: FailedQueue, MaxPriority: MaxPriority},
+			{Name: FailedQueue, Bindings: []Binding{{Exchange: DeadLetterExchange, Key: FailedQueue}}},
+			{Name: ResultsQueue},
+			{Name: WebhooksQueue, Bindings: []Binding{{Exchange: EventsExchange, Key: "#"}}},
+			{Name: StockAlertsQueue, Bindings: []Binding{
+				{Exchange: EventsExchange, Key: "item.created"},
+				{Exchange: EventsExchange, Key: "item.updated"},
+				{Exchange: EventsExchange, Key: "item.deleted"},
+			}},
+		},
+	}
+	for attempt := 1; attempt < policy.MaxAttempts; attempt++ {
+		t.Queues = append(t.Queues, QueueSpec{
+			Name:               policy.RetryQueue(attempt),
+			MessageTTL:         policy.Delay(attempt),
+			DeadLetterExchange: &defaultExchange,
+			DeadLetterKey:      ImageQueue,
+		})
+	}
+	return t
+}
+
+// routingMatches reports whether a routing key matches a binding key for
+// the given exchange kind (topic patterns support * and #).
+func routingMatches(kind, pattern, key string) bool {
+	if kind != ExchangeTopic {
+		return pattern == key
+	}
+	return topicMatch(strings.Split(pattern, "."), strings.Split(key, "."))
+}
+
+func topicMatch(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(key); i++ {
+			if topicMatch(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && topicMatch(pattern[1:], key[1:])
+	default:
+		return len(key) > 0 && pattern[0] == key[0] && topicMatch(pattern[1:], key[1:])
+	}
+}
+
+// NewBroker builds the broker named by driver ("amqp" or "memory").
+func NewBroker(driver, url string, policy RetryPolicy) (Broker, error) {
+	switch driver {
+	case "", "amqp":
+		return NewAMQPBroker(url, policy), nil
+	case "memory":
+		return NewMemoryBroker(policy), nil
+	default:
+		return nil, fmt.Errorf("unknown queue driver %q", driver)
+	}
+}
@@ -0,0 +1,40 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// cancelKeyPrefix namespaces the Redis keys marking cancelled job runs. The
+// AI worker checks for CancelKey(job_id, run) before processing a message,
+// so the two must stay in sync (ai_service/main.py).
+const cancelKeyPrefix = "inventory_ai:ai:cancelled:"
+
+// cancelTTL is how long a cancellation is remembered: longer than a message
+// can sit in ImageQueue and its retry queues.
+const cancelTTL = 7 * 24 * time.Hour
+
+// CancelKey is keyed by run so re-running a cancelled job does not revive
+// the message of the cancelled run.
+func CancelKey(jobID string, run int) string {
+	return fmt.Sprintf("%s%s:%d", cancelKeyPrefix, jobID, run)
+}
+
+// Cancellations tells workers which queued jobs they must skip. Messages
+// cannot be removed from the middle of a queue, so cancelled jobs stay in it
+// and are dropped when they are delivered.
+type Cancellations struct {
+	Redis *redis.Client
+}
+
+func NewCancellations(client *redis.Client) *Cancellations {
+	return &Cancellations{Redis: client}
+}
+
+// Cancel marks a run of jobID as cancelled.
+func (c *Cancellations) Cancel(ctx context.Context, jobID string, run int) error {
+	return c.Redis.Set(ctx, CancelKey(jobID, run), time.Now().Unix(), cancelTTL).Err()
+}
@@ -0,0 +1,209 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryBroker is an in-process Broker for tests and single-node
+// deployments without RabbitMQ. It follows the same Topology as
+// AMQPBroker: routing, dead-lettering on rejection and TTL delay queues
+// all behave alike, but nothing survives a restart.
+type MemoryBroker struct {
+	mu        sync.Mutex
+	exchanges map[string]ExchangeSpec
+	queues    map[string]*memQueue
+	closed    bool
+}
+
+type memQueue struct {
+	spec   QueueSpec
+	msgs   []memMessage
+	notify chan struct{} // signalled when msgs grows
+}
+
+type memMessage struct {
+	msg         Message
+	redelivered bool
+}
+
+func NewMemoryBroker(policy RetryPolicy) *MemoryBroker {
+	t := NewTopology(policy)
+	b := &MemoryBroker{
+		exchanges: map[string]ExchangeSpec{},
+		queues:    map[string]*memQueue{},
+	}
+	for _, ex := range t.Exchanges {
+		b.exchanges[ex.Name] = ex
+	}
+	for _, q := range t.Queues {
+		b.queues[q.Name] = &memQueue{spec: q, notify: make(chan struct{}, 1)}
+	}
+	return b
+}
+
+func (b *MemoryBroker) Connected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.closed
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, msg Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrNotConnected
+	}
+	b.route(msg, false)
+	return nil
+}
+
+// route delivers msg to every matching queue. Unroutable messages are
+// dropped, as RabbitMQ does without the mandatory flag. Callers hold mu.
+func (b *MemoryBroker) route(msg Message, redelivered bool) {
+	if msg.Exchange == "" {
+		if q, ok := b.queues[msg.RoutingKey]; ok {
+			b.enqueue(q, memMessage{msg: msg, redelivered: redelivered})
+		}
+		return
+	}
+
+	ex, ok := b.exchanges[msg.Exchange]
+	if !ok {
+		return
+	}
+	for _, q := range b.queues {
+		for _, bind := range q.spec.Bindings {
+			if bind.Exchange == ex.Name && routingMatches(ex.Kind, bind.Key, msg.RoutingKey) {
+				b.enqueue(q, memMessage{msg: msg, redelivered: redelivered})
+				break
+			}
+		}
+	}
+}
+
+// enqueue appends m to q, or, for TTL (delay) queues, holds it for the TTL
+// and then dead-letters it as expired. Callers hold mu.
+func (b *MemoryBroker) enqueue(q *memQueue, m memMessage) {
+	if q.spec.MessageTTL > 0 {
+		time.AfterFunc(q.spec.MessageTTL, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if !b.closed {
+				b.deadLetter(q, m.msg, "expired")
+			}
+		})
+		return
+	}
+
+	// Keep msgs ordered by priority, FIFO within a priority.
+	i := len(q.msgs)
+	if q.spec.MaxPriority > 0 {
+		p := min(m.msg.Priority, q.spec.MaxPriority)
+		for i > 0 && min(q.msgs[i-1].msg.Priority, q.spec.MaxPriority) < p {
+			i--
+		}
+	}
+	q.msgs = append(q.msgs, memMessage{})
+	copy(q.msgs[i+1:], q.msgs[i:])
+	q.msgs[i] = m
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// deadLetter forwards msg to q's dead-letter exchange, recording why in an
+// x-death header like RabbitMQ. Callers hold mu.
+func (b *MemoryBroker) deadLetter(q *memQueue, msg Message, reason string) {
+	if q.spec.DeadLetterExchange == nil {
+		return
+	}
+
+	headers := map[string]interface{}{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	death := map[string]interface{}{"reason": reason, "queue": q.spec.Name}
+	if prev, ok := headers["x-death"].([]interface{}); ok {
+		headers["x-death"] = append([]interface{}{death}, prev...)
+	} else {
+		headers["x-death"] = []interface{}{death}
+	}
+
+	msg.Exchange = *q.spec.DeadLetterExchange
+	msg.RoutingKey = q.spec.DeadLetterKey
+	msg.Headers = headers
+	b.route(msg, false)
+}
+
+// Consume delivers messages one at a time; the next message is handed out
+// once handle has returned, unless ctx has been cancelled by then.
+func (b *MemoryBroker) Consume(ctx context.Context, queue string, handle Handler) error {
+	b.mu.Lock()
+	q, ok := b.queues[queue]
+	b.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown queue %q", queue)
+	}
+
+	for ctx.Err() == nil {
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return fmt.Errorf("broker closed")
+		}
+		if len(q.msgs) == 0 {
+			b.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-q.notify:
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		m := q.msgs[0]
+		q.msgs = q.msgs[1:]
+		b.mu.Unlock()
+
+		var once sync.Once
+		settled := false
+		handle(ctx, &Delivery{
+			Message:     m.msg,
+			Redelivered: m.redelivered,
+			ack: func() error {
+				once.Do(func() { settled = true })
+				return nil
+			},
+			nack: func(requeue bool) error {
+				once.Do(func() {
+					settled = true
+					b.mu.Lock()
+					defer b.mu.Unlock()
+					if requeue {
+						b.enqueue(q, memMessage{msg: m.msg, redelivered: true})
+					} else {
+						b.deadLetter(q, m.msg, "rejected")
+					}
+				})
+				return nil
+			},
+		})
+		if !settled {
+			// Treat an unacknowledged delivery like a dropped consumer.
+			b.mu.Lock()
+			b.enqueue(q, memMessage{msg: m.msg, redelivered: true})
+			b.mu.Unlock()
+		}
+	}
+	return ctx.Err()
+}
+
+func (b *MemoryBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+}
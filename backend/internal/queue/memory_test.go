@@ -0,0 +1,223 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+const testTenant = "00000000-0000-0000-0000-000000000001"
+
+// receive consumes n deliveries from queue, settling each with settle, and
+// returns them. It fails the test if they do not arrive within a few
+// seconds.
+func receive(t *testing.T, b Broker, queue string, n int, settle func(*Delivery)) []*Delivery {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var got []*Delivery
+	err := b.Consume(ctx, queue, func(ctx context.Context, d *Delivery) {
+		got = append(got, d)
+		settle(d)
+		if len(got) == n {
+			cancel()
+		}
+	})
+	if len(got) < n {
+		t.Fatalf("got %d deliveries from %s, want %d (%v)", len(got), queue, n, err)
+	}
+	return got
+}
+
+// queued is how many messages wait in queue.
+func queued(b *MemoryBroker, queue string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.queues[queue].msgs)
+}
+
+func ack(d *Delivery) { d.Ack() }
+
+func TestMemoryBrokerRoutesEvents(t *testing.T) {
+	tests := []struct {
+		key         string
+		webhooks    int
+		stockAlerts int
+	}{
+		{"item.updated", 1, 1},
+		{"item.deleted", 1, 1},
+		{"warehouse.created", 1, 0},
+		{"ai.job.completed", 1, 0},
+		{"item.updated.extra", 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			b := NewMemoryBroker(DefaultRetryPolicy())
+			err := b.Publish(context.Background(), Message{
+				Exchange:   EventsExchange,
+				RoutingKey: tt.key,
+				MessageID:  "ev-1",
+				Headers:    map[string]interface{}{TenantHeader: testTenant},
+				Body:       []byte(`{"id":"1"}`),
+			})
+			if err != nil {
+				t.Fatalf("publish: %v", err)
+			}
+			if n := queued(b, WebhooksQueue); n != tt.webhooks {
+				t.Fatalf("%d messages for webhooks, want %d", n, tt.webhooks)
+			}
+			if n := queued(b, StockAlertsQueue); n != tt.stockAlerts {
+				t.Fatalf("%d messages for stock alerts, want %d", n, tt.stockAlerts)
+			}
+
+			d := receive(t, b, WebhooksQueue, 1, ack)[0]
+			if d.RoutingKey != tt.key || d.Exchange != EventsExchange || d.MessageID != "ev-1" {
+				t.Fatalf("delivered %s/%s id %q", d.Exchange, d.RoutingKey, d.MessageID)
+			}
+			if d.Headers[TenantHeader] != testTenant {
+				t.Fatalf("tenant header %v", d.Headers[TenantHeader])
+			}
+		})
+	}
+}
+
+func TestMemoryBrokerAckNackRequeue(t *testing.T) {
+	b := NewMemoryBroker(DefaultRetryPolicy())
+	msg := Message{RoutingKey: ResultsQueue, MessageID: "m-1", Body: []byte("x")}
+	if err := b.Publish(context.Background(), msg); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	first := receive(t, b, ResultsQueue, 1, func(d *Delivery) { d.Nack(true) })[0]
+	if first.Redelivered {
+		t.Fatal("first delivery marked redelivered")
+	}
+	// A delivery the handler neither acks nor nacks comes back as well.
+	second := receive(t, b, ResultsQueue, 1, func(*Delivery) {})[0]
+	third := receive(t, b, ResultsQueue, 1, ack)[0]
+	for _, d := range []*Delivery{second, third} {
+		if !d.Redelivered || d.MessageID != "m-1" {
+			t.Fatalf("redelivery %q, redelivered %v", d.MessageID, d.Redelivered)
+		}
+	}
+	if n := queued(b, ResultsQueue); n != 0 {
+		t.Fatalf("%d messages left after ack", n)
+	}
+
+	// Rejecting a message from a queue without a dead-letter exchange
+	// drops it.
+	b.Publish(context.Background(), msg)
+	receive(t, b, ResultsQueue, 1, func(d *Delivery) { d.Nack(false) })
+	if n := queued(b, ResultsQueue); n != 0 {
+		t.Fatalf("%d messages left after reject", n)
+	}
+}
+
+func TestMemoryBrokerRetriesThenDeadLetters(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 2, BaseDelay: 10 * time.Millisecond}
+	b := NewMemoryBroker(policy)
+	body, _ := json.Marshal(AIJob{JobID: "job-1", TenantID: testTenant})
+	err := b.Publish(context.Background(), Message{
+		RoutingKey: ImageQueue,
+		MessageID:  "ev-1",
+		Priority:   PriorityBulk,
+		Headers:    map[string]interface{}{TenantHeader: testTenant},
+		Body:       body,
+	})
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	retries := make(chan int, 2)
+	dead := make(chan DeadLetter, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	router := &RetryRouter{Broker: b, Policy: policy}
+	go router.Run(ctx,
+		func(ctx context.Context, job AIJob, attempt int, delay time.Duration) error {
+			retries <- attempt
+			return nil
+		},
+		func(ctx context.Context, dl DeadLetter) error {
+			dead <- dl
+			return nil
+		})
+
+	// The worker rejects the job: it goes through the failed queue and a
+	// delay queue back onto the image queue, counted.
+	rejected := receive(t, b, ImageQueue, 1, func(d *Delivery) { d.Nack(false) })[0]
+	if rejected.Headers[TenantHeader] != testTenant {
+		t.Fatalf("tenant header %v", rejected.Headers[TenantHeader])
+	}
+	retried := receive(t, b, ImageQueue, 1, func(d *Delivery) { d.Nack(false) })[0]
+	if attemptOf(retried.Headers) != 1 || retried.MessageID != "ev-1" || retried.Priority != PriorityBulk {
+		t.Fatalf("retried message: attempt %d, id %q, priority %d", attemptOf(retried.Headers), retried.MessageID, retried.Priority)
+	}
+	if reason := deathReason(retried.Headers); reason != "expired" {
+		t.Fatalf("retried message died %q, want expired from the delay queue", reason)
+	}
+	if got := <-retries; got != 1 {
+		t.Fatalf("retry attempt %d, want 1", got)
+	}
+
+	select {
+	case dl := <-dead:
+		if dl.Job == nil || dl.Job.JobID != "job-1" || dl.Attempts != 2 || dl.Reason != "rejected" {
+			t.Fatalf("dead letter %+v", dl)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("job was not dead-lettered")
+	}
+}
+
+func TestConsumeResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		failures int // handler errors before it succeeds
+		calls    int
+	}{
+		{"handled", `{"job_id":"job-1","status":"succeeded"}`, 0, 1},
+		{"malformed is dropped", `{"job_id":`, 0, 0},
+		{"without job is dropped", `{"status":"succeeded"}`, 0, 0},
+		{"handler error is requeued", `{"job_id":"job-1","status":"failed"}`, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemoryBroker(DefaultRetryPolicy())
+			if err := b.Publish(context.Background(), Message{RoutingKey: ResultsQueue, Body: []byte(tt.body)}); err != nil {
+				t.Fatalf("publish: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			calls := 0
+			go func() {
+				// Lets a dropped message through before stopping.
+				if tt.calls == 0 {
+					time.Sleep(200 * time.Millisecond)
+					cancel()
+				}
+			}()
+			ConsumeResults(ctx, b, func(ctx context.Context, res AIResult) error {
+				calls++
+				if res.JobID != "job-1" {
+					t.Errorf("job %q", res.JobID)
+				}
+				if calls <= tt.failures {
+					return errors.New("database down")
+				}
+				cancel()
+				return nil
+			})
+			if calls != tt.calls {
+				t.Fatalf("handler called %d times, want %d", calls, tt.calls)
+			}
+			if n := queued(b, ResultsQueue); n != 0 {
+				t.Fatalf("%d messages left", n)
+			}
+		})
+	}
+}
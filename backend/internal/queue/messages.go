@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Queue names shared with the Python AI worker. ImageQueue replaced
+// LegacyImageQueue (see migrate.go).
+const (
+	ImageQueue   = "ai.image_jobs"
+	ResultsQueue = "image_results_queue"
+)
+
+// EventsExchange is the topic exchange domain events (item.updated,
+// warehouse.created, ...) are published to, routed by event type. Each
+// event carries its tenant in the TenantHeader header.
+const EventsExchange = "inventory.events"
+
+const TenantHeader = "x-tenant-id"
+
+// WebhooksQueue receives every domain event for webhook fan-out.
+const WebhooksQueue = "webhook_events"
+
+// StockAlertsQueue receives item events for the low-stock evaluator.
+const StockAlertsQueue = "stock_alert_events"
+
+// Job priorities, as AMQP message priorities on ImageQueue. Interactive
+// scans jump ahead of bulk backfills.
+const (
+	PriorityBulk        uint8 = 1
+	PriorityInteractive uint8 = 5
+
+	// MaxPriority is ImageQueue's x-max-priority.
+	MaxPriority = PriorityInteractive
+)
+
+// Priority names accepted by the API.
+const (
+	PriorityNameInteractive = "interactive"
+	PriorityNameBulk        = "bulk"
+)
+
+// ParsePriority maps an API priority name to a message priority.
+func ParsePriority(name string) (uint8, bool) {
+	switch name {
+	case "", PriorityNameInteractive:
+		return PriorityInteractive, true
+	case PriorityNameBulk:
+		return PriorityBulk, true
+	}
+	return 0, false
+}
+
+// AIJob is the message the AI worker consumes from ImageQueue.
+type AIJob struct {
+	JobID     string `json:"job_id"`
+	TenantID  string `json:"tenant_id"`
+	ImageID   string `json:"image_id"`
+	UserID    string `json:"user_id"`
+	ImageURL  string `json:"image_url"`
+	ImageKey  string `json:"image_key"` // key in the blob store
+	Priority  uint8  `json:"priority"`
+	Timestamp int64  `json:"timestamp"`
+
+	// Run numbers a job's re-runs so results of an older run are ignored.
+	// ModelVersion and ConfidenceThreshold override the worker's defaults.
+	Run                 int     `json:"run,omitempty"`
+	ModelVersion        string  `json:"model_version,omitempty"`
+	ConfidenceThreshold float64 `json:"confidence_threshold,omitempty"`
+}
+
+// AIResult is published by the AI worker on ResultsQueue as a job moves
+// through processing.
+type AIResult struct {
+	JobID      string      `json:"job_id"`
+	TenantID   string      `json:"tenant_id"`
+	Status     string      `json:"status"` // processing, succeeded, failed
+	Detections []Detection `json:"detections"`
+	RawText    string      `json:"raw_text"`
+	Model      string      `json:"model"`
+	Error      string      `json:"error,omitempty"`
+	Run        int         `json:"run,omitempty"`
+	Timestamp  int64       `json:"timestamp"`
+}
+
+type Detection struct {
+	Name       string  `json:"name"`
+	Quantity   float64 `json:"quantity"`
+	Confidence float64 `json:"confidence"`
+}
+
+// ConsumeResults delivers AIResult messages from ResultsQueue to handle
+// until ctx is cancelled. Malformed messages are dropped; handler errors
+// are requeued after a short pause.
+func ConsumeResults(ctx context.Context, b Broker, handle func(context.Context, AIResult) error) error {
+	return b.Consume(ctx, ResultsQueue, func(ctx context.Context, d *Delivery) {
+		var res AIResult
+		if err := json.Unmarshal(d.Body, &res); err != nil || res.JobID == "" {
+			log.Printf("queue: dropping malformed result: %s", d.Body)
+			d.Ack()
+			return
+		}
+
+		if err := handle(ctx, res); err != nil {
+			log.Printf("queue: handling result for job %s failed: %v", res.JobID, err)
+			time.Sleep(time.Second)
+			d.Nack(true)
+			return
+		}
+		d.Ack()
+	})
+}
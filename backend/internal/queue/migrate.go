@@ -0,0 +1,98 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// LegacyImageQueue is the image queue of versions before dead-lettering
+// and priorities. It was declared without x-arguments, and RabbitMQ
+// refuses to redeclare an existing queue with different ones, so ImageQueue
+// has a new name and jobs still waiting here are moved over.
+const LegacyImageQueue = "image_processing_queue"
+
+// migrateLegacyImageQueue moves the messages of LegacyImageQueue to
+// ImageQueue and deletes it once it is empty. It does nothing when the
+// queue does not exist. Messages are acked only after the broker confirms
+// their copy, so an interrupted migration duplicates jobs rather than
+// losing them (results for a job that already finished are ignored).
+func migrateLegacyImageQueue(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	// A passive declare of a missing queue closes the channel, which is
+	// why this has a channel of its own.
+	if _, err := ch.QueueDeclarePassive(LegacyImageQueue, true, false, false, false, nil); err != nil {
+		var amqpErr *amqp.Error
+		if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+			return nil
+		}
+		return err
+	}
+	if err := ch.Confirm(false); err != nil {
+		return err
+	}
+
+	moved := 0
+	for {
+		d, ok, err := ch.Get(LegacyImageQueue, false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if err := republish(ch, d, ImageQueue); err != nil {
+			d.Nack(false, true)
+			return fmt.Errorf("move message %s: %v", d.MessageId, err)
+		}
+		if err := d.Ack(false); err != nil {
+			return err
+		}
+		moved++
+	}
+	if moved > 0 {
+		log.Printf("queue: moved %d jobs from %s to %s", moved, LegacyImageQueue, ImageQueue)
+	}
+
+	// ifEmpty: a backend still on the old version may have published
+	// since; its jobs are moved on the next connect.
+	if _, err := ch.QueueDelete(LegacyImageQueue, false, true, false); err != nil {
+		return fmt.Errorf("delete %s: %v", LegacyImageQueue, err)
+	}
+	log.Printf("queue: deleted %s", LegacyImageQueue)
+	return nil
+}
+
+// republish copies d to queue and waits for the broker's confirm.
+func republish(ch *amqp.Channel, d amqp.Delivery, queue string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	dc, err := ch.PublishWithDeferredConfirmWithContext(ctx, "", queue, false, false, amqp.Publishing{
+		ContentType:  d.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    d.MessageId,
+		Priority:     d.Priority,
+		Headers:      d.Headers,
+		Body:         d.Body,
+	})
+	if err != nil {
+		return err
+	}
+	acked, err := dc.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return ErrNacked
+	}
+	return nil
+}
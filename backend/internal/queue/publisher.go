@@ -1,79 +0,0 @@
-package queue
-
-import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"time"
-
-	amqp "github.com/rabbitmq/amqp091-go"
-)
-
-type Publisher struct {
-	Conn    *amqp.Connection
-	Channel *amqp.Channel
-	Queue   amqp.Queue
-}
-
-type AIJob struct {
-	ImageID   string `json:"image_id"`
-	UserID    string `json:"user_id"`
-	ImageURL  string `json:"image_url"` // or Base64
-	Timestamp int64  `json:"timestamp"`
-}
-
-func NewPublisher(url string) (*Publisher, error) {
-	conn, err := amqp.Dial(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to rabbitmq: %v", err)
-	}
-
-	ch, err := conn.Channel()
-	if err != nil {
-		return nil, fmt.Errorf("failed to open channel: %v", err)
-	}
-
-	q, err := ch.QueueDeclare(
-		"image_processing_queue", // name
-		true,                     // durable
-		false,                    // delete when unused
-		false,                    // exclusive
-		false,                    // no-wait
-		nil,                      // arguments
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to declare queue: %v", err)
-	}
-
-	return &Publisher{
-		Conn:    conn,
-		Channel: ch,
-		Queue:   q,
-	}, nil
-}
-
-func (p *Publisher) PublishJob(job AIJob) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	body, err := json.Marshal(job)
-	if err != nil {
-		return err
-	}
-
-	err = p.Channel.PublishWithContext(ctx,
-		"",           // exchange
-		p.Queue.Name, // routing key
-		false,        // mandatory
-		false,        // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		})
-	return err
-}
-
-func (p *Publisher) Close() {
-	p.Channel.Close()
-	p.Conn.Close()
-}
@@ -0,0 +1,199 @@
+package queue_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/outbox"
+	"github.com/inventory_ai/backend/internal/queue"
+	"github.com/inventory_ai/backend/internal/webhooks"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testStores returns a fresh Postgres schema (INVENTORY_TEST_POSTGRES_DSN)
+// and MongoDB database (INVENTORY_TEST_MONGO_URI), dropped after the test.
+// The test is skipped unless both are set.
+func testStores(t *testing.T) (*gorm.DB, *mongo.Database) {
+	t.Helper()
+	dsn, uri := os.Getenv("INVENTORY_TEST_POSTGRES_DSN"), os.Getenv("INVENTORY_TEST_MONGO_URI")
+	if dsn == "" || uri == "" {
+		t.Skip("INVENTORY_TEST_POSTGRES_DSN and INVENTORY_TEST_MONGO_URI not set")
+	}
+	ctx := context.Background()
+	name := "inventory_test_" + primitive.NewObjectID().Hex()
+
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("connect postgres: %v", err)
+	}
+	if err := admin.Exec("CREATE SCHEMA " + name).Error; err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + name + " CASCADE") })
+	if strings.Contains(dsn, "://") {
+		u, _ := url.Parse(dsn)
+		q := u.Query()
+		q.Set("search_path", name)
+		u.RawQuery = q.Encode()
+		dsn = u.String()
+	} else {
+		dsn += " search_path=" + name
+	}
+	pg, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("connect postgres: %v", err)
+	}
+	if err := pg.AutoMigrate(&models.OutboxEvent{}, &models.WebhookSubscription{}, &models.WebhookDelivery{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect mongo: %v", err)
+	}
+	db := client.Database(name)
+	t.Cleanup(func() {
+		db.Drop(ctx)
+		client.Disconnect(ctx)
+	})
+	return pg, db
+}
+
+// eventually polls cond until it holds, failing the test after timeout.
+func eventually(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// TestRelayToWebhookFanOut runs events from both outbox stores through the
+// relay and a MemoryBroker into the webhook dispatcher, and a job event
+// onto the image queue.
+func TestRelayToWebhookFanOut(t *testing.T) {
+	pg, db := testStores(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	received := map[string]http.Header{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received[r.Header.Get(webhooks.HeaderEvent)] = r.Header
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	tenant := uuid.New()
+	subs := []models.WebhookSubscription{
+		{TenantID: tenant, URL: server.URL, Secret: "s1", EventTypes: []string{"item.updated"}, Active: true},
+		{TenantID: tenant, URL: server.URL, Secret: "s2", EventTypes: []string{"warehouse.created"}, Active: true},
+		// Another tenant's subscription to everything gets nothing.
+		{TenantID: uuid.New(), URL: server.URL, Secret: "s3", EventTypes: []string{"*"}, Active: true},
+	}
+	if err := pg.Create(&subs).Error; err != nil {
+		t.Fatalf("create subscriptions: %v", err)
+	}
+
+	ob := &outbox.Outbox{PG: pg, Mongo: db}
+	if err := ob.EmitMongo(ctx, tenant.String(), "item.updated", map[string]string{"id": "item-1"}); err != nil {
+		t.Fatalf("emit mongo: %v", err)
+	}
+	if err := ob.EmitPG(pg, tenant.String(), "warehouse.created", map[string]string{"id": "wh-1"}); err != nil {
+		t.Fatalf("emit postgres: %v", err)
+	}
+	job, err := outbox.NewJobEvent(queue.AIJob{JobID: "job-1", TenantID: tenant.String(), Priority: queue.PriorityBulk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ob.AddMongo(ctx, job); err != nil {
+		t.Fatalf("add job: %v", err)
+	}
+
+	broker := queue.NewMemoryBroker(queue.DefaultRetryPolicy())
+	published := map[string]models.OutboxEvent{}
+	relay := &outbox.Relay{Outbox: ob, Broker: broker, OnPublished: func(ctx context.Context, ev models.OutboxEvent) {
+		mu.Lock()
+		published[ev.Type] = ev
+		mu.Unlock()
+	}}
+	go relay.Run(ctx)
+	eventually(t, 10*time.Second, "the relay", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(published) == 3
+	})
+
+	// The job goes straight to the image queue, with its priority.
+	jobCtx, stop := context.WithTimeout(ctx, 3*time.Second)
+	var delivered *queue.Delivery
+	broker.Consume(jobCtx, queue.ImageQueue, func(ctx context.Context, d *queue.Delivery) {
+		delivered = d
+		d.Ack()
+		stop()
+	})
+	stop()
+	if delivered == nil {
+		t.Fatal("job not on the image queue")
+	}
+	if delivered.MessageID != job.ID || delivered.Priority != queue.PriorityBulk || delivered.Headers[queue.TenantHeader] != tenant.String() {
+		t.Fatalf("job delivered as %q, priority %d, tenant %v", delivered.MessageID, delivered.Priority, delivered.Headers[queue.TenantHeader])
+	}
+
+	dispatcher := webhooks.NewDispatcher(pg, broker, 3)
+	// The test server listens on loopback, which the delivery client
+	// refuses.
+	dispatcher.Client = server.Client()
+	go dispatcher.Run(ctx)
+
+	var deliveries []models.WebhookDelivery
+	eventually(t, 15*time.Second, "webhook deliveries", func() bool {
+		deliveries = nil
+		pg.Where("status = ?", models.WebhookDeliverySucceeded).Find(&deliveries)
+		return len(deliveries) == 2
+	})
+	var all int64
+	pg.Model(&models.WebhookDelivery{}).Count(&all)
+	if all != 2 {
+		t.Fatalf("%d deliveries, want 2", all)
+	}
+	for _, del := range deliveries {
+		ev := published[del.EventType]
+		if del.TenantID != tenant || del.EventID != ev.ID {
+			t.Fatalf("delivery of %s: tenant %s, event %s; want %s, %s", del.EventType, del.TenantID, del.EventID, tenant, ev.ID)
+		}
+		var envelope webhooks.Envelope
+		if err := json.Unmarshal([]byte(del.Payload), &envelope); err != nil {
+			t.Fatalf("payload: %v", err)
+		}
+		if envelope.ID != ev.ID || envelope.Type != del.EventType || envelope.TenantID != tenant.String() {
+			t.Fatalf("envelope %+v", envelope)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, eventType := range []string{"item.updated", "warehouse.created"} {
+		if received[eventType] == nil {
+			t.Fatalf("no request for %s", eventType)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Dead-letter topology. The worker rejects a job it cannot process; the
+// broker routes it through DeadLetterExchange to FailedQueue, where the
+// RetryRouter either parks it in a delay queue (which expires it back onto
+// ImageQueue) or gives up and hands it to the dead-letter store.
+const (
+	DeadLetterExchange = "ai.dlx"
+	FailedQueue        = "image_processing_failed"
+
+	// AttemptHeader counts how many times a job has already failed.
+	AttemptHeader = "x-attempt"
+)
+
+// RetryPolicy decides how often and how late a failed job is retried.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 5, BaseDelay: 5 * time.Second}
+}
+
+// Delay is the backoff before retry number attempt (1-based): BaseDelay,
+// 2*BaseDelay, 4*BaseDelay, ...
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	return p.BaseDelay << (attempt - 1)
+}
+
+// RetryQueue names the delay queue used for retry number attempt. The delay
+// is part of the name because RabbitMQ refuses to redeclare a queue with a
+// different TTL.
+func (p RetryPolicy) RetryQueue(attempt int) string {
+	return fmt.Sprintf("%s.retry.%s", ImageQueue, p.Delay(attempt))
+}
+
+// DeadLetter is a job that ran out of attempts, or a message that could not
+// even be parsed.
+type DeadLetter struct {
+	Job      *AIJob // nil for unparseable messages
+	Body     []byte
+	Attempts int
+	Reason   string
+}
+
+// RetryRouter consumes FailedQueue and applies the RetryPolicy.
+type RetryRouter struct {
+	Broker Broker
+	Policy RetryPolicy
+}
+
+// Run routes failed jobs until ctx is cancelled. onRetry is told about each
+// scheduled retry; onDead must persist the dead letter before it is acked.
+func (r *RetryRouter) Run(ctx context.Context,
+	onRetry func(ctx context.Context, job AIJob, attempt int, delay time.Duration) error,
+	onDead func(ctx context.Context, dl DeadLetter) error,
+) error {
+	return r.Broker.Consume(ctx, FailedQueue, func(ctx context.Context, d *Delivery) {
+		if err := r.route(ctx, d, onRetry, onDead); err != nil {
+			log.Printf("queue: routing failed job: %v", err)
+			time.Sleep(time.Second)
+			d.Nack(true)
+			return
+		}
+		d.Ack()
+	})
+}
+
+func (r *RetryRouter) route(ctx context.Context, d *Delivery,
+	onRetry func(ctx context.Context, job AIJob, attempt int, delay time.Duration) error,
+	onDead func(ctx context.Context, dl DeadLetter) error,
+) error {
+	failed := attemptOf(d.Headers) + 1
+	reason := deathReason(d.Headers)
+
+	var job AIJob
+	if err := json.Unmarshal(d.Body, &job); err != nil || job.JobID == "" {
+		// Poison message: retrying cannot help.
+		return onDead(ctx, DeadLetter{Body: d.Body, Attempts: failed, Reason: "malformed message"})
+	}
+
+	if failed >= r.Policy.MaxAttempts {
+		return onDead(ctx, DeadLetter{Job: &job, Body: d.Body, Attempts: failed, Reason: reason})
+	}
+
+	err := r.Broker.Publish(ctx, Message{
+		RoutingKey: r.Policy.RetryQueue(failed),
+		MessageID:  d.MessageID,
+		Priority:   d.Priority,
+		Headers:    map[string]interface{}{AttemptHeader: int32(failed)},
+		Body:       d.Body,
+	})
+	if err != nil {
+		return err
+	}
+	return onRetry(ctx, job, failed, r.Policy.Delay(failed))
+}
+
+// attemptOf reads AttemptHeader, tolerating the integer types AMQP clients
+// use.
+func attemptOf(h map[string]interface{}) int {
+	switch v := h[AttemptHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// deathReason extracts why the broker dead-lettered a message (rejected,
+// expired, ...) from the most recent x-death entry.
+func deathReason(h map[string]interface{}) string {
+	deaths, ok := h["x-death"].([]interface{})
+	if !ok || len(deaths) == 0 {
+		return "rejected"
+	}
+	death, _ := deaths[0].(map[string]interface{})
+	if reason, ok := death["reason"].(string); ok {
+		return reason
+	}
+	return "rejected"
+}
@@ -0,0 +1,302 @@
+// Package search is a small embedded full-text index with typo tolerance.
+// Documents are indexed as character trigrams, which are stored with the
+// document and used to find candidates; candidates are then ranked by
+// matching query terms against the document's words, allowing a few typos
+// per word, and the matches are highlighted.
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Field is one searchable piece of text of a document. Matches in fields
+// with a higher Weight rank higher.
+type Field struct {
+	Name   string
+	Text   string
+	Weight float64
+}
+
+// Token is a lowercased word of a text and its byte span in that text.
+type Token struct {
+	Text       string
+	Start, End int
+}
+
+// Tokenize splits s into lowercased words of letters and digits. Words that
+// mix letters and digits (e.g. "500ml") also yield their parts ("500",
+// "ml"), so either form can be searched.
+func Tokenize(s string) []Token {
+	var tokens []Token
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := s[start:end]
+		tokens = append(tokens, Token{Text: strings.ToLower(word), Start: start, End: end})
+		tokens = append(tokens, splitLetterDigit(word, start)...)
+		start = -1
+	}
+	for i, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+	}
+	flush(len(s))
+	return tokens
+}
+
+// splitLetterDigit returns the letter and digit runs of a mixed word; none
+// if the word is all letters or all digits.
+func splitLetterDigit(word string, offset int) []Token {
+	var parts []Token
+	runStart, runDigit := 0, false
+	for i, r := range word {
+		digit := unicode.IsDigit(r)
+		if i > 0 && digit != runDigit {
+			parts = append(parts, Token{Text: strings.ToLower(word[runStart:i]), Start: offset + runStart, End: offset + i})
+			runStart = i
+		}
+		runDigit = digit
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return append(parts, Token{Text: strings.ToLower(word[runStart:]), Start: offset + runStart, End: offset + len(word)})
+}
+
+// grams appends the trigrams of a word, padded at the start so prefixes
+// weigh in; words under three letters are their own gram.
+func grams(word string, out map[string]struct{}) {
+	runes := []rune(" " + word)
+	if len(runes) <= 3 {
+		out[word] = struct{}{}
+		return
+	}
+	for i := 0; i+3 <= len(runes); i++ {
+		out[string(runes[i:i+3])] = struct{}{}
+	}
+}
+
+// Grams returns the distinct trigrams of all fields, to be stored with the
+// document and indexed.
+func Grams(fields ...Field) []string {
+	set := map[string]struct{}{}
+	for _, f := range fields {
+		for _, t := range Tokenize(f.Text) {
+			grams(t.Text, set)
+		}
+	}
+	out := make([]string, 0, len(set))
+	for g := range set {
+		out = append(out, g)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Query is a parsed search query.
+type Query struct {
+	Terms []string
+}
+
+// ParseQuery splits q into distinct terms.
+func ParseQuery(q string) Query {
+	seen := map[string]bool{}
+	var terms []string
+	for _, t := range Tokenize(q) {
+		if !seen[t.Text] {
+			seen[t.Text] = true
+			terms = append(terms, t.Text)
+		}
+	}
+	return Query{Terms: terms}
+}
+
+// Grams returns the trigrams of the query's terms, used to find candidates.
+func (q Query) Grams() []string {
+	set := map[string]struct{}{}
+	for _, t := range q.Terms {
+		grams(t, set)
+	}
+	out := make([]string, 0, len(set))
+	for g := range set {
+		out = append(out, g)
+	}
+	return out
+}
+
+// Match is the result of scoring a document against a query.
+type Match struct {
+	Score float64
+	// Highlights maps field names to their text (or, for long texts, an
+	// excerpt) with matched words wrapped in <mark></mark>.
+	Highlights map[string]string
+}
+
+// Score ranks fields against q. Each term scores its best match in any
+// field: exact word 1, word prefix 0.8, word within the typo tolerance 0.6
+// less 0.15 per edit, times the field's weight. The sum is scaled by the
+// share of terms that matched at all, so documents matching every term come
+// first. A zero Score means no term matched.
+func (q Query) Score(fields ...Field) Match {
+	m := Match{Highlights: map[string]string{}}
+	if len(q.Terms) == 0 {
+		return m
+	}
+
+	marks := make([][]Token, len(fields))
+	matched := 0
+	for _, term := range q.Terms {
+		best := 0.0
+		for i, f := range fields {
+			for _, tok := range Tokenize(f.Text) {
+				s := matchWord(term, tok.Text)
+				if s == 0 {
+					continue
+				}
+				marks[i] = append(marks[i], tok)
+				if s*f.Weight > best {
+					best = s * f.Weight
+				}
+			}
+		}
+		if best > 0 {
+			matched++
+			m.Score += best
+		}
+	}
+	m.Score *= float64(matched) / float64(len(q.Terms))
+
+	for i, f := range fields {
+		if len(marks[i]) > 0 {
+			m.Highlights[f.Name] = highlight(f.Text, marks[i])
+		}
+	}
+	return m
+}
+
+func matchWord(term, word string) float64 {
+	if term == word {
+		return 1
+	}
+	if utf8.RuneCountInString(term) >= 2 && strings.HasPrefix(word, term) {
+		return 0.8
+	}
+	tol := Tolerance(term)
+	if tol == 0 {
+		return 0
+	}
+	if d := Distance(term, word); d <= tol {
+		return 0.6 - 0.15*float64(d-1)
+	}
+	return 0
+}
+
+// Tolerance is how many typos a term may contain: none up to three
+// letters, one up to six, two beyond.
+func Tolerance(term string) int {
+	switch n := utf8.RuneCountInString(term); {
+	case n <= 3:
+		return 0
+	case n <= 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Distance is the optimal string alignment distance between a and b:
+// insertions, deletions, substitutions and transpositions of adjacent
+// letters each count as one edit.
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > 2 {
+		// Beyond any tolerance; skip the table.
+		return abs(len(ra) - len(rb))
+	}
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// excerptRadius is how many bytes of context a long field keeps around its
+// first match.
+const excerptRadius = 60
+
+// highlight wraps the marked spans of text in <mark></mark>. Spans may
+// overlap (a word and its letter/digit parts); the widest wins.
+func highlight(text string, marks []Token) string {
+	sort.Slice(marks, func(i, j int) bool {
+		if marks[i].Start != marks[j].Start {
+			return marks[i].Start < marks[j].Start
+		}
+		return marks[i].End > marks[j].End
+	})
+
+	from, to := 0, len(text)
+	if len(text) > 2*excerptRadius+40 {
+		from = max(marks[0].Start-excerptRadius, 0)
+		to = min(marks[0].End+excerptRadius, len(text))
+		for from > 0 && !utf8.RuneStart(text[from]) {
+			from--
+		}
+		for to < len(text) && !utf8.RuneStart(text[to]) {
+			to++
+		}
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, m := range marks {
+		if m.Start < pos || m.End > to {
+			continue
+		}
+		b.WriteString(text[pos:m.Start])
+		b.WriteString("<mark>")
+		b.WriteString(text[m.Start:m.End])
+		b.WriteString("</mark>")
+		pos = m.End
+	}
+	b.WriteString(text[pos:to])
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
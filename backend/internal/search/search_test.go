@@ -0,0 +1,212 @@
+package search
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []Token
+	}{
+		{"", nil},
+		{" -- ", nil},
+		{"Stainless Washer M8", []Token{
+			{"stainless", 0, 9}, {"washer", 10, 16}, {"m8", 17, 19}, {"m", 17, 18}, {"8", 18, 19},
+		}},
+		{"500ml, 2-pack", []Token{
+			{"500ml", 0, 5}, {"500", 0, 3}, {"ml", 3, 5}, {"2", 7, 8}, {"pack", 9, 13},
+		}},
+		// Spans are byte offsets into the original text.
+		{"Café Crème 2ℓ", []Token{
+			{"café", 0, 5}, {"crème", 6, 12}, {"2ℓ", 13, 17}, {"2", 13, 14}, {"ℓ", 14, 17},
+		}},
+		{"ÄPFEL", []Token{{"äpfel", 0, 6}}},
+		{"東京タワー", []Token{{"東京タワー", 0, 15}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := Tokenize(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Tokenize(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrams(t *testing.T) {
+	got := Grams(Field{Text: "Bolt M8"}, Field{Text: "bolt"})
+	want := []string{" bo", "8", "bol", "m", "m8", "olt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Grams = %q, want %q", got, want)
+	}
+	if got := ParseQuery("Crème crème").Grams(); len(got) != 4 {
+		t.Fatalf("query grams %q, want the 4 of one term", got)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	got := ParseQuery("Bolt bolt, M8").Terms
+	want := []string{"bolt", "m8", "m", "8"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("terms %q, want %q", got, want)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"washer", "washer", 0},
+		{"washer", "wahser", 1}, // transposition
+		{"washer", "washr", 1},
+		{"washer", "wqsher", 1},
+		{"stainless", "stianles", 2},
+		{"kitten", "sitting", 3},
+		{"café", "cafe", 1}, // counted in runes, not bytes
+		{"crème", "creme", 1},
+		{"abc", "abcdef", 3},
+	}
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("Distance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestTolerance(t *testing.T) {
+	tests := []struct {
+		term string
+		want int
+	}{
+		{"m8", 0},
+		{"nut", 0},
+		{"東京", 0},
+		{"bolt", 1},
+		{"café", 1},
+		{"washer", 1},
+		{"stainless", 2},
+	}
+	for _, tt := range tests {
+		if got := Tolerance(tt.term); got != tt.want {
+			t.Errorf("Tolerance(%q) = %d, want %d", tt.term, got, tt.want)
+		}
+	}
+}
+
+func TestScoreTypos(t *testing.T) {
+	tests := []struct {
+		query, text string
+		want        float64
+	}{
+		{"washer", "Washer", 1},
+		{"wash", "Washer", 0.8},         // prefix
+		{"wahser", "Washer", 0.6},       // one typo
+		{"stianles", "Stainless", 0.45}, // two typos in a long word
+		{"stxinlxsx", "Stainless", 0},   // three
+		{"blt", "Bolt", 0},              // short words allow no typo
+		{"w", "Washer", 0},              // nor prefixes of one letter
+		{"creme", "Crème", 0.6},
+		{"crème", "Creme", 0.6},
+		{"東京", "東京タワー", 0.8},
+		{"washer bolt", "Washer", 0.5}, // half the terms matched
+	}
+	for _, tt := range tests {
+		t.Run(tt.query+"/"+tt.text, func(t *testing.T) {
+			got := ParseQuery(tt.query).Score(Field{Name: "name", Text: tt.text, Weight: 1}).Score
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("score %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreRanking(t *testing.T) {
+	type doc struct{ name, description string }
+	docs := []doc{
+		{"Bolt", ""},
+		{"Steel nut", "fits any bolt"},
+		{"Washer", ""},
+		{"Steel bolt M8", ""},
+		{"Spare part", "steel bolt"},
+		{"Steal bolt", ""},
+	}
+	q := ParseQuery("steel bolt")
+	type hit struct {
+		name  string
+		score float64
+	}
+	var hits []hit
+	for _, d := range docs {
+		m := q.Score(Field{Name: "name", Text: d.name, Weight: 5}, Field{Name: "description", Text: d.description, Weight: 1})
+		if m.Score > 0 {
+			hits = append(hits, hit{d.name, m.Score})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+
+	var got []string
+	for _, h := range hits {
+		got = append(got, h.name)
+	}
+	// Both terms exactly in the name; one with a typo; one in the name and
+	// one in the description; one of two in the name; both in the
+	// description.
+	want := []string{"Steel bolt M8", "Steal bolt", "Steel nut", "Bolt", "Spare part"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ranking %q, want %q (%v)", got, want, hits)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		query, text, want string
+	}{
+		{"wash", "Washer, washing powder", "<mark>Washer</mark>, <mark>washing</mark> powder"},
+		// The word wins over its overlapping digit part.
+		{"500", "500ml bottle", "<mark>500ml</mark> bottle"},
+		{"ml", "500ml bottle", "500<mark>ml</mark> bottle"},
+		{"creme", "Café Crème brûlée", "Café <mark>Crème</mark> brûlée"},
+		{"café brûlée", "Café Crème brûlée", "<mark>Café</mark> Crème <mark>brûlée</mark>"},
+		{"タワー", "東京 タワー", "東京 <mark>タワー</mark>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			m := ParseQuery(tt.query).Score(Field{Name: "name", Text: tt.text, Weight: 1})
+			if got := m.Highlights["name"]; got != tt.want {
+				t.Fatalf("highlight %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	m := ParseQuery("bolt").Score(Field{Name: "name", Text: "Nut", Weight: 1})
+	if _, ok := m.Highlights["name"]; ok {
+		t.Fatal("highlighted a field without matches")
+	}
+}
+
+func TestHighlightExcerptKeepsRunes(t *testing.T) {
+	// Two-byte letters throughout, so a cut at a fixed byte offset would
+	// land inside one.
+	filler := strings.Repeat("é", 41)
+	text := filler + " " + filler + " Crème " + filler + " " + filler
+	got := ParseQuery("creme").Score(Field{Name: "description", Text: text, Weight: 1}).Highlights["description"]
+
+	if !utf8.ValidString(got) {
+		t.Fatalf("excerpt is not valid UTF-8: %q", got)
+	}
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") {
+		t.Fatalf("excerpt not marked as cut: %q", got)
+	}
+	if !strings.Contains(got, " <mark>Crème</mark> ") {
+		t.Fatalf("excerpt %q lacks the match", got)
+	}
+	if len(got) >= len(text) {
+		t.Fatalf("excerpt is %d bytes of %d", len(got), len(text))
+	}
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrBadSignature is returned for blob URLs whose signature is missing,
+// wrong or expired.
+var ErrBadSignature = errors.New("invalid or expired blob URL")
+
+// Signer signs blob URLs so that whoever holds one (the AI worker, a
+// browser) can fetch that blob without credentials until it expires, and
+// nothing else.
+type Signer struct {
+	Key []byte
+	TTL time.Duration
+}
+
+func NewSigner(key string, ttl time.Duration) *Signer {
+	return &Signer{Key: []byte(key), TTL: ttl}
+}
+
+func (s *Signer) sign(key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(strings.TrimLeft(key, "/")))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Query returns the query string that signs key until TTL from now.
+func (s *Signer) Query(key string) string {
+	expires := time.Now().Add(s.TTL).Unix()
+	return url.Values{
+		"expires": {strconv.FormatInt(expires, 10)},
+		"sig":     {s.sign(key, expires)},
+	}.Encode()
+}
+
+// Verify checks the expires and sig query parameters of a request for key.
+func (s *Signer) Verify(key, expires, sig string) error {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return ErrBadSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.sign(key, exp))) {
+		return ErrBadSignature
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignerVerify(t *testing.T) {
+	s := NewSigner("secret", time.Hour)
+	q, err := url.ParseQuery(s.Query("tenants/t1/images/a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires, sig := q.Get("expires"), q.Get("sig")
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name, key, expires, sig string
+		ok                      bool
+	}{
+		{"signed", "tenants/t1/images/a.jpg", expires, sig, true},
+		{"leading slash", "/tenants/t1/images/a.jpg", expires, sig, true},
+		{"other key", "tenants/t2/images/a.jpg", expires, sig, false},
+		{"later expiry", "tenants/t1/images/a.jpg", expires + "0", sig, false},
+		{"expired", "tenants/t1/images/a.jpg", past, NewSigner("secret", 0).sign("tenants/t1/images/a.jpg", mustInt(t, past)), false},
+		{"other secret", "tenants/t1/images/a.jpg", expires, NewSigner("other", time.Hour).sign("tenants/t1/images/a.jpg", mustInt(t, expires)), false},
+		{"no signature", "tenants/t1/images/a.jpg", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Verify(tt.key, tt.expires, tt.sig)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Verify = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLocalStoreURLIsSigned(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "http://backend:8080/uploads/", NewSigner("secret", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(store.URL("/tenants/t1/images/a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/uploads/tenants/t1/images/a.jpg" {
+		t.Fatalf("path = %q", u.Path)
+	}
+	key := strings.TrimPrefix(u.Path, "/uploads/")
+	if err := store.Signer.Verify(key, u.Query().Get("expires"), u.Query().Get("sig")); err != nil {
+		t.Fatalf("URL does not verify: %v", err)
+	}
+}
+
+func mustInt(t *testing.T, s string) int64 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
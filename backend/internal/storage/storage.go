@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when a blob does not exist in the store.
+var ErrNotFound = errors.New("blob not found")
+
+// Object describes a blob after it has been persisted.
+type Object struct {
+	Key         string `json:"key"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// BlobStore persists uploaded files (images for AI analysis, for now).
+// Keys are slash-separated and relative to the store root; the local
+// filesystem implementation is the default, an S3-compatible one can be
+// dropped in later without touching the handlers.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (Object, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// URL returns a URL the blob can be fetched from without credentials.
+	// It expires, so it is handed out when needed rather than stored.
+	URL(key string) string
+}
@@ -0,0 +1,95 @@
+// Package units converts quantities between units of measure: the
+// standard units every tenant has and the tenant's own (models.Unit).
+package units
+
+import (
+	"math"
+
+	"github.com/inventory_ai/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Error is a unit problem to report to the client.
+type Error struct {
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// Round rounds q to the precision quantities are kept at, so that
+// conversions do not leave floating point noise in stock.
+func Round(q float64) float64 {
+	return math.Round(q*1e6) / 1e6
+}
+
+// Catalogue is the units a tenant can use, by code.
+type Catalogue map[string]models.Unit
+
+// Load returns the standard units and the tenant's own.
+func Load(db *gorm.DB, tenantID string) (Catalogue, error) {
+	var custom []models.Unit
+	if err := db.Where("tenant_id = ?", tenantID).Find(&custom).Error; err != nil {
+		return nil, err
+	}
+	cat := Catalogue{}
+	for _, u := range models.StandardUnits {
+		cat[u.Code] = u
+	}
+	for _, u := range custom {
+		cat[u.Code] = u
+	}
+	return cat, nil
+}
+
+// Base follows code's definition down to a base unit and returns it with
+// the factor from code to it.
+func (cat Catalogue) Base(code string) (string, float64, bool) {
+	factor := 1.0
+	for range len(cat) {
+		u, ok := cat[code]
+		if !ok {
+			return "", 0, false
+		}
+		if u.BaseCode == "" {
+			return code, factor, true
+		}
+		factor *= u.Factor
+		code = u.BaseCode
+	}
+	return "", 0, false
+}
+
+// ToBase converts q from unit ("" being DefaultUnit) into its base unit
+// and returns it with that unit. A unit missing from the catalogue is kept
+// as it is.
+func (cat Catalogue) ToBase(q float64, unit string) (float64, string) {
+	if unit == "" {
+		unit = models.DefaultUnit
+	}
+	base, factor, ok := cat.Base(unit)
+	if !ok {
+		return q, unit
+	}
+	return q * factor, base
+}
+
+// Convert converts q from one unit into another.
+func (cat Catalogue) Convert(q float64, from, to string) (float64, error) {
+	if from == to {
+		return q, nil
+	}
+	fromBase, fromFactor, ok := cat.Base(from)
+	if !ok {
+		return 0, &Error{"Unknown unit " + from}
+	}
+	toBase, toFactor, ok := cat.Base(to)
+	if !ok {
+		return 0, &Error{"Unknown unit " + to}
+	}
+	if fromBase != toBase {
+		return 0, &Error{"Cannot convert " + from + " to " + to}
+	}
+	return Round(q * fromFactor / toFactor), nil
+}
@@ -0,0 +1,119 @@
+package units
+
+import (
+	"testing"
+
+	"github.com/inventory_ai/backend/internal/models"
+)
+
+// testCatalogue is the standard units with a box of 24 pcs, a case of 4
+// boxes and a unit whose definition loops.
+func testCatalogue() Catalogue {
+	cat := Catalogue{}
+	for _, u := range models.StandardUnits {
+		cat[u.Code] = u
+	}
+	cat["box"] = models.Unit{Code: "box", BaseCode: "pcs", Factor: 24}
+	cat["case"] = models.Unit{Code: "case", BaseCode: "box", Factor: 4}
+	cat["a"] = models.Unit{Code: "a", BaseCode: "b", Factor: 2}
+	cat["b"] = models.Unit{Code: "b", BaseCode: "a", Factor: 2}
+	return cat
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		in, want float64
+	}{
+		{0.1 + 0.2, 0.3},
+		{1.0000004, 1},
+		{1.0000005, 1.000001},
+		{-2.5e-7, 0},
+		{24, 24},
+	}
+	for _, tt := range tests {
+		if got := Round(tt.in); got != tt.want {
+			t.Errorf("Round(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBase(t *testing.T) {
+	cat := testCatalogue()
+	tests := []struct {
+		code   string
+		base   string
+		factor float64
+		ok     bool
+	}{
+		{"pcs", "pcs", 1, true},
+		{"dozen", "pcs", 12, true},
+		{"box", "pcs", 24, true},
+		{"case", "pcs", 96, true},
+		{"g", "kg", 0.001, true},
+		{"crate", "", 0, false},
+		{"a", "", 0, false}, // defined in a loop
+	}
+	for _, tt := range tests {
+		base, factor, ok := cat.Base(tt.code)
+		if base != tt.base || factor != tt.factor || ok != tt.ok {
+			t.Errorf("Base(%q) = %q, %v, %v; want %q, %v, %v", tt.code, base, factor, ok, tt.base, tt.factor, tt.ok)
+		}
+	}
+}
+
+func TestToBase(t *testing.T) {
+	cat := testCatalogue()
+	tests := []struct {
+		q    float64
+		unit string
+		want float64
+		base string
+	}{
+		{3, "", 3, "pcs"},
+		{3, "box", 72, "pcs"},
+		{0.5, "case", 48, "pcs"},
+		{250, "g", 0.25, "kg"},
+		{3, "crate", 3, "crate"}, // unknown units are kept
+	}
+	for _, tt := range tests {
+		q, base := cat.ToBase(tt.q, tt.unit)
+		if Round(q) != tt.want || base != tt.base {
+			t.Errorf("ToBase(%v, %q) = %v %s, want %v %s", tt.q, tt.unit, q, base, tt.want, tt.base)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	cat := testCatalogue()
+	tests := []struct {
+		q        float64
+		from, to string
+		want     float64
+		err      string
+	}{
+		{5, "pcs", "pcs", 5, ""},
+		{2, "box", "pcs", 48, ""},
+		{48, "pcs", "box", 2, ""},
+		{1, "case", "box", 4, ""},
+		{12, "pcs", "case", 0.125, ""},
+		{1, "pcs", "box", 0.041667, ""}, // rounded
+		{3, "dozen", "box", 1.5, ""},
+		{1500, "g", "kg", 1.5, ""},
+		{0.1, "ml", "l", 0.0001, ""},
+		{1, "pcs", "kg", 0, "Cannot convert pcs to kg"},
+		{1, "crate", "pcs", 0, "Unknown unit crate"},
+		{1, "pcs", "crate", 0, "Unknown unit crate"},
+	}
+	for _, tt := range tests {
+		got, err := cat.Convert(tt.q, tt.from, tt.to)
+		if tt.err != "" {
+			if ue, ok := err.(*Error); !ok || ue.Msg != tt.err {
+				t.Errorf("Convert(%v, %s, %s) error %v, want %q", tt.q, tt.from, tt.to, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Convert(%v, %s, %s) = %v, %v; want %v", tt.q, tt.from, tt.to, got, err, tt.want)
+		}
+	}
+}
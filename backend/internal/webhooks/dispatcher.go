@@ -0,0 +1,268 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/inventory_ai/backend/internal/models"
+	"github.com/inventory_ai/backend/internal/queue"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	pollInterval = 2 * time.Second
+	batchSize    = 20
+	// lease hides a claimed delivery from other senders while it is sent.
+	lease = time.Minute
+	// maxLogResponse caps how much of a response body is kept per attempt.
+	maxLogResponse = 512
+	// retention is how long finished deliveries are kept for the logs.
+	retention = 30 * 24 * time.Hour
+
+	DefaultMaxAttempts = 8
+)
+
+// Dispatcher turns broker events into deliveries and sends them.
+type Dispatcher struct {
+	PG     *gorm.DB
+	Broker queue.Broker
+	Client *http.Client
+
+	// MaxAttempts is how many times a delivery is tried before it is
+	// marked failed.
+	MaxAttempts int
+}
+
+func NewDispatcher(pg *gorm.DB, broker queue.Broker, maxAttempts int) *Dispatcher {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	return &Dispatcher{
+		PG:          pg,
+		Broker:      broker,
+		Client:      NewClient(10 * time.Second),
+		MaxAttempts: maxAttempts,
+	}
+}
+
+// Run consumes events and sends due deliveries until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	go func() {
+		if err := d.Broker.Consume(ctx, queue.WebhooksQueue, d.fanOut); err != nil && ctx.Err() == nil {
+			log.Printf("webhooks: event consumer stopped: %v", err)
+		}
+	}()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		d.sendDue(ctx)
+
+		if time.Since(lastCleanup) > time.Hour {
+			d.cleanup(ctx)
+			lastCleanup = time.Now()
+		}
+	}
+}
+
+// fanOut creates a pending delivery of an event for each matching
+// subscription of its tenant. Deliveries are keyed by subscription and
+// event id, so a redelivered event is not sent twice.
+func (d *Dispatcher) fanOut(ctx context.Context, del *queue.Delivery) {
+	tenantID, _ := del.Headers[queue.TenantHeader].(string)
+	tenant, err := uuid.Parse(tenantID)
+	if err != nil || del.MessageID == "" {
+		// Not a tenant event (or from before events carried a tenant).
+		del.Ack()
+		return
+	}
+	eventType := del.RoutingKey
+
+	var subs []models.WebhookSubscription
+	if err := d.PG.WithContext(ctx).Where("tenant_id = ? AND active", tenant).Find(&subs).Error; err != nil {
+		log.Printf("webhooks: load subscriptions for %s failed: %v", tenantID, err)
+		time.Sleep(time.Second)
+		del.Nack(true)
+		return
+	}
+
+	var deliveries []models.WebhookDelivery
+	var body []byte
+	for _, sub := range subs {
+		if !sub.Wants(eventType) {
+			continue
+		}
+		if body == nil {
+			body, err = json.Marshal(Envelope{
+				ID:        del.MessageID,
+				Type:      eventType,
+				TenantID:  tenantID,
+				CreatedAt: time.Now().UTC(),
+				Data:      json.RawMessage(del.Body),
+			})
+			if err != nil {
+				log.Printf("webhooks: dropping event %s with invalid payload: %v", del.MessageID, err)
+				del.Ack()
+				return
+			}
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			TenantID:       tenant,
+			SubscriptionID: sub.ID,
+			EventID:        del.MessageID,
+			EventType:      eventType,
+			Payload:        string(body),
+			Status:         models.WebhookDeliveryPending,
+			NextAttemptAt:  time.Now(),
+			Log:            []models.WebhookAttempt{},
+		})
+	}
+	if len(deliveries) > 0 {
+		err := d.PG.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error
+		if err != nil {
+			log.Printf("webhooks: store deliveries of event %s failed: %v", del.MessageID, err)
+			time.Sleep(time.Second)
+			del.Nack(true)
+			return
+		}
+	}
+	del.Ack()
+}
+
+// sendDue claims due pending deliveries and attempts each once.
+func (d *Dispatcher) sendDue(ctx context.Context) {
+	now := time.Now()
+	var due []models.WebhookDelivery
+	err := d.PG.WithContext(ctx).Raw(`
+		UPDATE webhook_deliveries SET next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, now.Add(lease), models.WebhookDeliveryPending, now, batchSize).Scan(&due).Error
+	if err != nil {
+		log.Printf("webhooks: claim deliveries failed: %v", err)
+		return
+	}
+	for _, del := range due {
+		d.attempt(ctx, del)
+	}
+}
+
+// attempt sends one delivery and records the outcome.
+func (d *Dispatcher) attempt(ctx context.Context, del models.WebhookDelivery) {
+	var sub models.WebhookSubscription
+	err := d.PG.WithContext(ctx).Where("id = ?", del.SubscriptionID).First(&sub).Error
+	if err == gorm.ErrRecordNotFound || (err == nil && !sub.Active) {
+		d.finish(ctx, del, models.WebhookAttempt{At: time.Now(), Error: "subscription deleted or inactive"}, false, true)
+		return
+	}
+	if err != nil {
+		log.Printf("webhooks: load subscription %s failed: %v", del.SubscriptionID, err)
+		return // retried when the lease expires
+	}
+
+	result := d.send(ctx, sub, del)
+	ok := result.Error == "" && result.StatusCode >= 200 && result.StatusCode < 300
+	d.finish(ctx, del, result, ok, false)
+}
+
+// send posts the delivery payload, signed with the subscription secret.
+func (d *Dispatcher) send(ctx context.Context, sub models.WebhookSubscription, del models.WebhookDelivery) models.WebhookAttempt {
+	start := time.Now()
+	result := models.WebhookAttempt{At: start}
+	body := []byte(del.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	ts := start.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "InventoryAI-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, del.EventType)
+	req.Header.Set(HeaderDelivery, del.ID.String())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, ts, body))
+
+	resp, err := d.Client.Do(req)
+	result.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Error bodies are not kept: the tenant reads the log, and an
+		// error page is the most likely thing to leak what is behind the
+		// target.
+		result.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+		return result
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxLogResponse))
+	result.Response = string(snippet)
+	return result
+}
+
+// finish logs an attempt and either completes the delivery or schedules
+// the next try. It gives up after MaxAttempts, or at once if giveUp.
+func (d *Dispatcher) finish(ctx context.Context, del models.WebhookDelivery, result models.WebhookAttempt, ok, giveUp bool) {
+	now := time.Now()
+	del.Attempts++
+	del.Log = append(del.Log, result)
+	del.UpdatedAt = now
+	switch {
+	case ok:
+		del.Status = models.WebhookDeliverySucceeded
+		del.DeliveredAt = &now
+	case giveUp || del.Attempts >= d.MaxAttempts:
+		del.Status = models.WebhookDeliveryFailed
+	default:
+		del.NextAttemptAt = now.Add(Backoff(del.Attempts))
+	}
+
+	err := d.PG.WithContext(ctx).Model(&del).
+		Select("attempts", "log", "updated_at", "status", "delivered_at", "next_attempt_at").
+		Updates(&del).Error
+	if err != nil {
+		log.Printf("webhooks: update delivery %s failed: %v", del.ID, err)
+	}
+}
+
+func (d *Dispatcher) cleanup(ctx context.Context) {
+	err := d.PG.WithContext(ctx).
+		Where("status <> ? AND updated_at < ?", models.WebhookDeliveryPending, time.Now().Add(-retention)).
+		Delete(&models.WebhookDelivery{}).Error
+	if err != nil {
+		log.Printf("webhooks: cleanup failed: %v", err)
+	}
+}
+
+// Backoff is the delay before attempt n+1: 30s, 1m, 2m, ... up to six hours.
+func Backoff(attempts int) time.Duration {
+	d := 30 * time.Second << (attempts - 1)
+	if attempts < 1 || d <= 0 || d > 6*time.Hour {
+		return 6 * time.Hour
+	}
+	return d
+}
@@ -0,0 +1,132 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Webhooks are posted from inside the backend's network, so their targets
+// are limited to public addresses: otherwise a tenant could point one at
+// an internal service and read its replies in the delivery log. URLs are
+// checked when a subscription is saved and every connection is checked
+// again when it is dialled, since a name can resolve elsewhere later.
+
+// ErrBlockedTarget is returned for webhook targets that are not public.
+var ErrBlockedTarget = errors.New("webhook target is not a public address")
+
+// blockedNetworks are ranges not covered by the net.IP predicates used in
+// publicIP that are still not the public internet.
+var blockedNetworks = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // "this" network
+		"100.64.0.0/10", // carrier-grade NAT
+		"192.0.0.0/24",  // IETF protocol assignments
+		"198.18.0.0/15", // benchmarking
+		"240.0.0.0/4",   // reserved
+		"64:ff9b::/96",  // NAT64, can embed private IPv4 addresses
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// publicIP reports whether ip is a public unicast address.
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range blockedNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// internalHost reports whether host is a name that only means something
+// inside a private network: a single label such as "redis", or a name
+// under a local or cluster-internal domain.
+func internalHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if !strings.Contains(host, ".") {
+		return true
+	}
+	for _, suffix := range []string{".localhost", ".local", ".internal", ".localdomain", ".svc", ".cluster.local", ".home.arpa"} {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckURL returns an error unless rawURL is an absolute http(s) URL whose
+// host is public: an IP literal must be a public address, and a name must
+// not be internal and must resolve to public addresses only.
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("URL must be an absolute http(s) URL")
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !publicIP(ip) {
+			return ErrBlockedTarget
+		}
+		return nil
+	}
+	if internalHost(host) {
+		return ErrBlockedTarget
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return errors.New("URL host does not resolve")
+	}
+	for _, a := range addrs {
+		if !publicIP(a.IP) {
+			return ErrBlockedTarget
+		}
+	}
+	return nil
+}
+
+// checkDial refuses connections to addresses that are not public. It runs
+// after name resolution, on the address actually dialled.
+func checkDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return ErrBlockedTarget
+	}
+	return nil
+}
+
+// NewClient returns the HTTP client deliveries are sent with. It only
+// connects to public addresses, ignores proxy settings and does not
+// follow redirects (a redirect counts as a failed delivery).
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: checkDial}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
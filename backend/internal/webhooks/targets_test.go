@@ -0,0 +1,59 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{"http://127.0.0.1:8080/hook", true},
+		{"http://[::1]/hook", true},
+		{"http://10.1.2.3/hook", true},
+		{"http://172.16.0.9/hook", true},
+		{"http://192.168.1.1/hook", true},
+		{"http://169.254.169.254/latest/meta-data", true},
+		{"http://100.64.0.1/hook", true},
+		{"http://0.0.0.0/hook", true},
+		{"http://[::ffff:127.0.0.1]/hook", true},
+		{"http://[fd00::1]/hook", true},
+		{"http://rabbitmq:15672/api/overview", true},
+		{"http://redis:6379", true},
+		{"http://localhost/hook", true},
+		{"http://backend.default.svc/hook", true},
+		{"http://mongo.cluster.local/hook", true},
+		{"https://93.184.216.34/hook", false},
+		{"https://[2606:4700::1111]/hook", false},
+	}
+	for _, tt := range tests {
+		err := CheckURL(context.Background(), tt.url)
+		if blocked := err == ErrBlockedTarget; blocked != tt.blocked {
+			t.Errorf("CheckURL(%q) = %v, want blocked %v", tt.url, err, tt.blocked)
+		}
+	}
+
+	for _, bad := range []string{"ftp://example.com/", "/relative", "http://"} {
+		if err := CheckURL(context.Background(), bad); err == nil || err == ErrBlockedTarget {
+			t.Errorf("CheckURL(%q) = %v, want an invalid URL error", bad, err)
+		}
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal secret"))
+	}))
+	defer server.Close()
+
+	resp, err := NewClient(2 * time.Second).Get(server.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("client connected to a loopback address")
+	}
+}
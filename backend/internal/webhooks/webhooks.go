@@ -0,0 +1,88 @@
+// Package webhooks delivers domain events to tenant-registered HTTP
+// endpoints. Events arrive from the broker (queue.WebhooksQueue), are fanned
+// out into one delivery row per matching subscription, and a sender posts
+// due deliveries with retries and backoff.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// EventTypes are the event types a subscription may ask for; "*" stands for
+// all of them.
+var EventTypes = []string{
+	"ai.job.completed",
+	"ai.job.failed",
+	"ai.job.cancelled",
+	"item.created",
+	"item.updated",
+	"item.deleted",
+	"item.low_stock",
+	"warehouse.created",
+	"warehouse.updated",
+	"warehouse.deleted",
+	"category.created",
+	"category.updated",
+	"category.deleted",
+	"transfer.created",
+	"transfer.dispatched",
+	"transfer.received",
+	"transfer.cancelled",
+}
+
+// ValidEventType reports whether t may be subscribed to.
+func ValidEventType(t string) bool {
+	if t == "*" {
+		return true
+	}
+	for _, known := range EventTypes {
+		if known == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Request headers set on every delivery.
+const (
+	HeaderEvent     = "X-InventoryAI-Event"
+	HeaderDelivery  = "X-InventoryAI-Delivery"
+	HeaderTimestamp = "X-InventoryAI-Timestamp"
+	HeaderSignature = "X-InventoryAI-Signature"
+)
+
+// Sign computes the signature header value for body sent at timestamp:
+// "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed
+// with the subscription secret. Receivers should recompute it and reject
+// stale timestamps to prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret returns a random signing secret.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Envelope is the JSON body of every delivery.
+type Envelope struct {
+	ID        string          `json:"id"` // event id, stable across retries and redeliveries
+	Type      string          `json:"type"`
+	TenantID  string          `json:"tenant_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
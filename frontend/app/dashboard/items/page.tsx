@@ -9,7 +9,14 @@ import { Input } from '@/components/ui/input';
 const fetcher = (url: string) => api.get(url).then(res => res.data);
 
 export default function ItemsPage() {
-    const { data: items, error, isLoading, mutate } = useSWR('/items', fetcher);
+    // Cursors of the pages before the current one; the last is the current page's.
+    const [cursors, setCursors] = useState<string[]>([]);
+    const cursor = cursors[cursors.length - 1];
+    const { data, error, isLoading, mutate } = useSWR(
+        cursor ? `/items?cursor=${encodeURIComponent(cursor)}` : '/items',
+        fetcher,
+    );
+    const items = data?.items;
 
     const [saving, setSaving] = useState(false);
     const [actionError, setActionError] = useState('');
@@ -24,6 +31,7 @@ export default function ItemsPage() {
     const [editSku, setEditSku] = useState('');
     const [editQty, setEditQty] = useState('0');
     const [editPrice, setEditPrice] = useState('0');
+    const [editVersion, setEditVersion] = useState(0);
 
     const createItem = async () => {
         setActionError('');
@@ -64,6 +72,7 @@ export default function ItemsPage() {
         setEditSku(item.sku || '');
         setEditQty(String(item.quantity ?? 0));
         setEditPrice(String(item.price ?? 0));
+        setEditVersion(item.version ?? 0);
     };
 
     const cancelEdit = () => {
@@ -95,10 +104,17 @@ export default function ItemsPage() {
                 sku: editSku.trim(),
                 quantity: qty,
                 price: price,
-            });
+            }, { headers: { 'If-Match': `"${editVersion}"` } });
             await mutate();
             cancelEdit();
         } catch (e: any) {
+            if (e?.response?.status === 412) {
+                // Someone else saved first: show their values to merge with.
+                startEdit(e.response.data.current);
+                setActionError('This item was changed by someone else. Review the latest values and save again.');
+                await mutate();
+                return;
+            }
             setActionError(e?.response?.data?.error || 'Failed to update item');
         } finally {
             setSaving(false);
@@ -131,7 +147,7 @@ export default function ItemsPage() {
                 <div className="grid grid-cols-1 md:grid-cols-5 gap-3">
                     <Input placeholder="Name" value={newName} onChange={(e) => setNewName(e.target.value)} />
                     <Input placeholder="SKU" value={newSku} onChange={(e) => setNewSku(e.target.value)} />
-                    <Input placeholder="Quantity" inputMode="numeric" value={newQty} onChange={(e) => setNewQty(e.target.value)} />
+                    <Input placeholder="Quantity" inputMode="decimal" value={newQty} onChange={(e) => setNewQty(e.target.value)} />
                     <Input placeholder="Price" inputMode="decimal" value={newPrice} onChange={(e) => setNewPrice(e.target.value)} />
                     <Button isLoading={saving} onClick={createItem}>Add Item</Button>
                 </div>
@@ -194,9 +210,9 @@ export default function ItemsPage() {
                                     </td>
                                     <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-900">
                                         {editingId === item.id ? (
-                                            <Input inputMode="numeric" value={editQty} onChange={(e) => setEditQty(e.target.value)} />
+                                            <Input inputMode="decimal" value={editQty} onChange={(e) => setEditQty(e.target.value)} />
                                         ) : (
-                                            item.quantity
+                                            `${item.quantity} ${item.unit || 'pcs'}`
                                         )}
                                     </td>
                                     <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
@@ -228,6 +244,21 @@ export default function ItemsPage() {
                         </tbody>
                     </table>
                 </div>
+                <div className="flex items-center justify-end gap-2 px-6 py-3 border-t border-gray-200">
+                    <Button
+                        className="bg-gray-200 text-black hover:bg-gray-300"
+                        disabled={cursors.length === 0}
+                        onClick={() => setCursors(cursors.slice(0, -1))}
+                    >
+                        Previous
+                    </Button>
+                    <Button
+                        disabled={!data?.has_more}
+                        onClick={() => setCursors([...cursors, data.next_cursor])}
+                    >
+                        Next
+                    </Button>
+                </div>
             </div>
         </div>
     );
@@ -7,8 +7,9 @@ import { Package, Warehouse, AlertTriangle } from 'lucide-react';
 const fetcher = (url: string) => api.get(url).then(res => res.data);
 
 export default function DashboardPage() {
-    const { data: items, error: itemsError } = useSWR('/items', fetcher);
+    const { data: items, error: itemsError } = useSWR('/items?limit=1&count=true', fetcher);
     const { data: warehouses, error: whError } = useSWR('/warehouses', fetcher);
+    const { data: alerts } = useSWR('/alerts?status=open&limit=1', fetcher);
 
     const loading = !items && !itemsError;
 
@@ -21,7 +22,7 @@ export default function DashboardPage() {
                 <div className="bg-white p-6 rounded-xl shadow border border-gray-100 flex items-center justify-between">
                     <div>
                         <p className="text-gray-500 text-sm font-medium">Total Items</p>
-                        <h3 className="text-3xl font-bold text-gray-900">{items?.length || 0}</h3>
+                        <h3 className="text-3xl font-bold text-gray-900">{items?.total || 0}</h3>
                     </div>
                     <div className="p-3 bg-indigo-50 rounded-full text-indigo-600">
                         <Package className="w-8 h-8" />
@@ -43,7 +44,7 @@ export default function DashboardPage() {
                 <div className="bg-white p-6 rounded-xl shadow border border-gray-100 flex items-center justify-between">
                     <div>
                         <p className="text-gray-500 text-sm font-medium">Low Stock Alerts</p>
-                        <h3 className="text-3xl font-bold text-gray-900">0</h3>
+                        <h3 className="text-3xl font-bold text-gray-900">{alerts?.counts?.open || 0}</h3>
                     </div>
                     <div className="p-3 bg-red-50 rounded-full text-red-600">
                         <AlertTriangle className="w-8 h-8" />